@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mandelsoft/kubipam/pkg/cni"
+)
+
+func main() {
+	args := cni.ArgsFromEnv()
+	version := "0.3.0"
+	if args.Command == "VERSION" {
+		json.NewEncoder(os.Stdout).Encode(&cni.VersionInfo{
+			CNIVersion:        cni.SupportedVersions[len(cni.SupportedVersions)-1],
+			SupportedVersions: cni.SupportedVersions,
+		})
+		return
+	}
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		exit(version, cni.NewError(cni.ERR_DECODE, "cannot read network configuration: %s", err))
+	}
+	conf, err := cni.ParseNetConf(data)
+	if err != nil {
+		exit(version, err)
+	}
+	version = conf.CNIVersion
+	plugin, err := cni.NewPlugin(conf, args)
+	if err != nil {
+		exit(version, err)
+	}
+	switch args.Command {
+	case "ADD":
+		result, err := plugin.Add()
+		if err != nil {
+			exit(version, err)
+		}
+		if err := result.Print(os.Stdout, version); err != nil {
+			exit(version, err)
+		}
+	case "CHECK":
+		err = plugin.Check()
+	case "DEL":
+		err = plugin.Del()
+	default:
+		err = cni.NewError(cni.ERR_INVALID_CONFIG, "unknown CNI command %q", args.Command)
+	}
+	if err != nil {
+		exit(version, err)
+	}
+}
+
+// exit reports an error according to the CNI specification.
+func exit(version string, err error) {
+	e, ok := err.(*cni.Error)
+	if !ok {
+		e = cni.NewError(cni.ERR_INTERNAL, "%s", err)
+	}
+	e.CNIVersion = version
+	json.NewEncoder(os.Stdout).Encode(e)
+	fmt.Fprintln(os.Stderr, e.Error())
+	os.Exit(1)
+}
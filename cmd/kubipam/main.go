@@ -24,6 +24,9 @@ import (
 	_ "github.com/gardener/controller-manager-library/pkg/resources/defaultscheme/v1.16"
 
 	_ "github.com/mandelsoft/kubipam/pkg/controllers/ipam"
+	_ "github.com/mandelsoft/kubipam/pkg/controllers/nodes"
+	_ "github.com/mandelsoft/kubipam/pkg/controllers/services"
+	_ "github.com/mandelsoft/kubipam/pkg/webhooks/ipam"
 )
 
 func main() {
@@ -27,6 +27,400 @@ func init() {
 	var data string
 	data = `
 
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  annotations:
+    controller-gen.kubebuilder.io/version: v0.2.4
+  creationTimestamp: null
+  name: clusteripamranges.ipam.mandelsoft.org
+spec:
+  group: ipam.mandelsoft.org
+  names:
+    kind: ClusterIPAMRange
+    listKind: ClusterIPAMRangeList
+    plural: clusteripamranges
+    shortNames:
+    - ciprange
+    singular: clusteripamrange
+  scope: Cluster
+  versions:
+  - additionalPrinterColumns:
+    - jsonPath: .spec.mode
+      name: Mode
+      type: string
+    - jsonPath: .spec.parent.name
+      name: Parent
+      type: string
+    - jsonPath: .status.free
+      name: Free
+      type: string
+    - jsonPath: .status.state
+      name: STATE
+      type: string
+    name: v1alpha1
+    schema:
+      openAPIV3Schema:
+        description: ClusterIPAMRange is a cluster wide range usable by requests
+          and ranges of all namespaces.
+        properties:
+          apiVersion:
+            description: 'APIVersion defines the versioned schema of this representation
+              of an object. Servers should convert recognized schemas to the latest
+              internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources'
+            type: string
+          kind:
+            description: 'Kind is a string value representing the REST resource this
+              object represents. Servers may infer this from the endpoint the client
+              submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds'
+            type: string
+          metadata:
+            type: object
+          spec:
+            properties:
+              allowedNamespaces:
+                description: AllowedNamespaces restricts the namespaces of requests
+                  and sub ranges allowed to allocate from this range. Without restriction
+                  all namespaces are allowed.
+                properties:
+                  names:
+                    description: Names is a list of allowed namespaces
+                    items:
+                      type: string
+                    type: array
+                  selector:
+                    description: Selector selects allowed namespaces by their labels
+                    properties:
+                      matchExpressions:
+                        description: matchExpressions is a list of label selector requirements.
+                          The requirements are ANDed.
+                        items:
+                          description: A label selector requirement is a selector that
+                            contains values, a key, and an operator that relates the key
+                            and values.
+                          properties:
+                            key:
+                              description: key is the label key that the selector applies
+                                to.
+                              type: string
+                            operator:
+                              description: operator represents a key's relationship to
+                                a set of values. Valid operators are In, NotIn, Exists
+                                and DoesNotExist.
+                              type: string
+                            values:
+                              description: values is an array of string values. If the
+                                operator is In or NotIn, the values array must be non-empty.
+                                If the operator is Exists or DoesNotExist, the values
+                                array must be empty. This array is replaced during a
+                                strategic merge patch.
+                              items:
+                                type: string
+                              type: array
+                          required:
+                          - key
+                          - operator
+                          type: object
+                        type: array
+                      matchLabels:
+                        additionalProperties:
+                          type: string
+                        description: matchLabels is a map of {key,value} pairs. A single
+                          {key,value} in the matchLabels map is equivalent to an element
+                          of matchExpressions, whose key field is "key", the operator
+                          is "In", and the values array contains only "value". The requirements
+                          are ANDed.
+                        type: object
+                    type: object
+                type: object
+              avoidBoundaryAddresses:
+                description: AvoidBoundaryAddresses is the netmask size (/<size>)
+                  of aligned blocks, whose first and last addresses are skipped
+                  for single address allocations
+                type: string
+              checkpoint:
+                description: Checkpoint enables checkpointing of the allocation
+                  state in the status of the range (Status) or in a config map (ConfigMap)
+                type: string
+              chunkSize:
+                type: integer
+              ipFamilies:
+                description: IPFamilies requests an allocation for each given IP
+                  family (IPv4 or IPv6) of a dual-stack parent range
+                items:
+                  type: string
+                type: array
+              mode:
+                type: string
+              parent:
+                description: Parent is an IPAMRange or ClusterIPAMRange the ranges
+                  of this range are allocated from
+                properties:
+                  kind:
+                    description: Kind is the kind of the referenced range, IPAMRange
+                      (default) or ClusterIPAMRange
+                    type: string
+                  name:
+                    type: string
+                  namespace:
+                    type: string
+                required:
+                - name
+                type: object
+              quotas:
+                description: Quotas limit the allocations of requests and sub ranges
+                  per namespace. The first quota matching a namespace is used.
+                items:
+                  properties:
+                    addresses:
+                      description: Addresses is the maximum number of addresses allocated
+                        for a namespace
+                      type: string
+                    namespace:
+                      description: Namespace is the namespace the quota applies to
+                      type: string
+                    requests:
+                      description: Requests is the maximum number of requests and
+                        sub ranges with allocations of a namespace
+                      type: integer
+                    selector:
+                      description: Selector selects the namespaces the quota applies
+                        to by their labels. The limits apply to every selected namespace
+                        separately.
+                      properties:
+                        matchExpressions:
+                          description: matchExpressions is a list of label selector requirements.
+                            The requirements are ANDed.
+                          items:
+                            description: A label selector requirement is a selector that
+                              contains values, a key, and an operator that relates the key
+                              and values.
+                            properties:
+                              key:
+                                description: key is the label key that the selector applies
+                                  to.
+                                type: string
+                              operator:
+                                description: operator represents a key's relationship to
+                                  a set of values. Valid operators are In, NotIn, Exists
+                                  and DoesNotExist.
+                                type: string
+                              values:
+                                description: values is an array of string values. If the
+                                  operator is In or NotIn, the values array must be non-empty.
+                                  If the operator is Exists or DoesNotExist, the values
+                                  array must be empty. This array is replaced during a
+                                  strategic merge patch.
+                                items:
+                                  type: string
+                                type: array
+                            required:
+                            - key
+                            - operator
+                            type: object
+                          type: array
+                        matchLabels:
+                          additionalProperties:
+                            type: string
+                          description: matchLabels is a map of {key,value} pairs. A single
+                            {key,value} in the matchLabels map is equivalent to an element
+                            of matchExpressions, whose key field is "key", the operator
+                            is "In", and the values array contains only "value". The requirements
+                            are ANDed.
+                          type: object
+                      type: object
+                  type: object
+                type: array
+              ranges:
+                items:
+                  type: string
+                type: array
+              releaseCooldown:
+                description: ReleaseCooldown is the time released cidrs are kept
+                  busy before they can be allocated again
+                type: string
+              request:
+                description: Request describes the allocation requested from the
+                  parent range
+                type: string
+              reserved:
+                description: Reserved are addresses of the ranges, which must
+                  never be allocated, given as cidr, ip range or single ip
+                items:
+                  type: string
+                type: array
+            type: object
+          status:
+            properties:
+              checkpoint:
+                description: Checkpoint is the checkpointed allocation state, if
+                  checkpointing into the status is enabled
+                items:
+                  type: string
+                type: array
+              cidrs:
+                description: CIDRs are the cidrs allocated from the parent range
+                items:
+                  type: string
+                type: array
+              conditions:
+                description: Conditions describe the result of consistency checks
+                items:
+                  properties:
+                    lastTransitionTime:
+                      description: LastTransitionTime is the time the condition
+                        changed its status
+                      format: date-time
+                      type: string
+                    message:
+                      description: Message describes the details of the condition
+                      type: string
+                    reason:
+                      description: Reason is a short machine readable reason for
+                        the condition
+                      type: string
+                    status:
+                      description: Status of the condition (True or False)
+                      type: string
+                    type:
+                      description: Type of the condition
+                      type: string
+                  required:
+                  - status
+                  - type
+                  type: object
+                type: array
+              conflicts:
+                description: Conflicts lists overlapping allocations of different
+                  objects found by the consistency check
+                items:
+                  type: string
+                type: array
+              cooling:
+                description: Cooling are the released cidrs still in their release
+                  cooldown
+                items:
+                  properties:
+                    cidr:
+                      description: CIDR is the released cidr
+                      type: string
+                    until:
+                      description: Until is the end of the cooldown
+                      format: date-time
+                      type: string
+                  required:
+                  - cidr
+                  - until
+                  type: object
+                type: array
+              deletePending:
+                items:
+                  type: string
+                type: array
+              free:
+                description: Free summarizes the free addresses and the largest
+                  free block of all ip families
+                type: string
+              message:
+                type: string
+              namespaces:
+                description: Namespaces describes the allocations of the range per
+                  namespace
+                items:
+                  properties:
+                    addresses:
+                      description: Addresses is the number of allocated addresses
+                      type: string
+                    namespace:
+                      description: Namespace is the namespace of the requests and
+                        sub ranges
+                      type: string
+                    requests:
+                      description: Requests is the number of requests and sub ranges
+                        with allocations
+                      type: integer
+                  required:
+                  - addresses
+                  - namespace
+                  - requests
+                  type: object
+                type: array
+              orphans:
+                description: Orphans lists allocated cidrs not used by any object
+                  found by the consistency check
+                items:
+                  type: string
+                type: array
+              reserved:
+                description: Reserved are the reserved cidrs excluded from allocation
+                items:
+                  type: string
+                type: array
+              roundRobin:
+                items:
+                  type: string
+                type: array
+              state:
+                type: string
+              usage:
+                description: Usage describes the utilization of the range per
+                  ip family
+                items:
+                  properties:
+                    cooling:
+                      description: Cooling is the number of released addresses
+                        still in their release cooldown
+                      type: string
+                    family:
+                      description: Family is the ip family (IPv4 or IPv6)
+                      type: string
+                    fragmentation:
+                      description: Fragmentation is the ratio of free addresses
+                        not part of the largest free block
+                      type: string
+                    free:
+                      description: Free is the number of addresses available for
+                        allocation
+                      type: string
+                    largestFree:
+                      description: LargestFree is the netmask size of the largest
+                        allocatable block
+                      type: string
+                    reserved:
+                      description: Reserved is the number of reserved addresses
+                      type: string
+                    total:
+                      description: Total is the number of managed addresses
+                      type: string
+                    used:
+                      description: Used is the number of allocated addresses
+                      type: string
+                  required:
+                  - family
+                  - free
+                  - total
+                  - used
+                  type: object
+                type: array
+            type: object
+        required:
+        - spec
+        type: object
+    served: true
+    storage: true
+    subresources:
+      status: {}
+status:
+  acceptedNames:
+    kind: ""
+    plural: ""
+  conditions: []
+  storedVersions: []
+  `
+	utils.Must(registry.RegisterCRD(data))
+	data = `
+
 ---
 apiVersion: apiextensions.k8s.io/v1
 kind: CustomResourceDefinition
@@ -50,6 +444,12 @@ spec:
     - jsonPath: .spec.mode
       name: Mode
       type: string
+    - jsonPath: .spec.parent.name
+      name: Parent
+      type: string
+    - jsonPath: .status.free
+      name: Free
+      type: string
     - jsonPath: .status.state
       name: STATE
       type: string
@@ -71,27 +471,330 @@ spec:
             type: object
           spec:
             properties:
+              allowedNamespaces:
+                description: AllowedNamespaces restricts the namespaces of requests
+                  and sub ranges allowed to allocate from this range. Without restriction
+                  all namespaces are allowed.
+                properties:
+                  names:
+                    description: Names is a list of allowed namespaces
+                    items:
+                      type: string
+                    type: array
+                  selector:
+                    description: Selector selects allowed namespaces by their labels
+                    properties:
+                      matchExpressions:
+                        description: matchExpressions is a list of label selector requirements.
+                          The requirements are ANDed.
+                        items:
+                          description: A label selector requirement is a selector that
+                            contains values, a key, and an operator that relates the key
+                            and values.
+                          properties:
+                            key:
+                              description: key is the label key that the selector applies
+                                to.
+                              type: string
+                            operator:
+                              description: operator represents a key's relationship to
+                                a set of values. Valid operators are In, NotIn, Exists
+                                and DoesNotExist.
+                              type: string
+                            values:
+                              description: values is an array of string values. If the
+                                operator is In or NotIn, the values array must be non-empty.
+                                If the operator is Exists or DoesNotExist, the values
+                                array must be empty. This array is replaced during a
+                                strategic merge patch.
+                              items:
+                                type: string
+                              type: array
+                          required:
+                          - key
+                          - operator
+                          type: object
+                        type: array
+                      matchLabels:
+                        additionalProperties:
+                          type: string
+                        description: matchLabels is a map of {key,value} pairs. A single
+                          {key,value} in the matchLabels map is equivalent to an element
+                          of matchExpressions, whose key field is "key", the operator
+                          is "In", and the values array contains only "value". The requirements
+                          are ANDed.
+                        type: object
+                    type: object
+                type: object
+              avoidBoundaryAddresses:
+                description: AvoidBoundaryAddresses is the netmask size (/<size>)
+                  of aligned blocks, whose first and last addresses are skipped
+                  for single address allocations
+                type: string
+              checkpoint:
+                description: Checkpoint enables checkpointing of the allocation
+                  state in the status of the range (Status) or in a config map (ConfigMap)
+                type: string
               chunkSize:
                 type: integer
+              ipFamilies:
+                description: IPFamilies requests an allocation for each given IP
+                  family (IPv4 or IPv6) of a dual-stack parent range
+                items:
+                  type: string
+                type: array
               mode:
                 type: string
+              parent:
+                description: Parent is an IPAMRange or ClusterIPAMRange the ranges
+                  of this range are allocated from
+                properties:
+                  kind:
+                    description: Kind is the kind of the referenced range, IPAMRange
+                      (default) or ClusterIPAMRange
+                    type: string
+                  name:
+                    type: string
+                  namespace:
+                    type: string
+                required:
+                - name
+                type: object
+              quotas:
+                description: Quotas limit the allocations of requests and sub ranges
+                  per namespace. The first quota matching a namespace is used.
+                items:
+                  properties:
+                    addresses:
+                      description: Addresses is the maximum number of addresses allocated
+                        for a namespace
+                      type: string
+                    namespace:
+                      description: Namespace is the namespace the quota applies to
+                      type: string
+                    requests:
+                      description: Requests is the maximum number of requests and
+                        sub ranges with allocations of a namespace
+                      type: integer
+                    selector:
+                      description: Selector selects the namespaces the quota applies
+                        to by their labels. The limits apply to every selected namespace
+                        separately.
+                      properties:
+                        matchExpressions:
+                          description: matchExpressions is a list of label selector requirements.
+                            The requirements are ANDed.
+                          items:
+                            description: A label selector requirement is a selector that
+                              contains values, a key, and an operator that relates the key
+                              and values.
+                            properties:
+                              key:
+                                description: key is the label key that the selector applies
+                                  to.
+                                type: string
+                              operator:
+                                description: operator represents a key's relationship to
+                                  a set of values. Valid operators are In, NotIn, Exists
+                                  and DoesNotExist.
+                                type: string
+                              values:
+                                description: values is an array of string values. If the
+                                  operator is In or NotIn, the values array must be non-empty.
+                                  If the operator is Exists or DoesNotExist, the values
+                                  array must be empty. This array is replaced during a
+                                  strategic merge patch.
+                                items:
+                                  type: string
+                                type: array
+                            required:
+                            - key
+                            - operator
+                            type: object
+                          type: array
+                        matchLabels:
+                          additionalProperties:
+                            type: string
+                          description: matchLabels is a map of {key,value} pairs. A single
+                            {key,value} in the matchLabels map is equivalent to an element
+                            of matchExpressions, whose key field is "key", the operator
+                            is "In", and the values array contains only "value". The requirements
+                            are ANDed.
+                          type: object
+                      type: object
+                  type: object
+                type: array
               ranges:
                 items:
                   type: string
                 type: array
-            required:
-            - ranges
+              releaseCooldown:
+                description: ReleaseCooldown is the time released cidrs are kept
+                  busy before they can be allocated again
+                type: string
+              request:
+                description: Request describes the allocation requested from the
+                  parent range
+                type: string
+              reserved:
+                description: Reserved are addresses of the ranges, which must
+                  never be allocated, given as cidr, ip range or single ip
+                items:
+                  type: string
+                type: array
             type: object
           status:
             properties:
+              checkpoint:
+                description: Checkpoint is the checkpointed allocation state, if
+                  checkpointing into the status is enabled
+                items:
+                  type: string
+                type: array
+              cidrs:
+                description: CIDRs are the cidrs allocated from the parent range
+                items:
+                  type: string
+                type: array
+              conditions:
+                description: Conditions describe the result of consistency checks
+                items:
+                  properties:
+                    lastTransitionTime:
+                      description: LastTransitionTime is the time the condition
+                        changed its status
+                      format: date-time
+                      type: string
+                    message:
+                      description: Message describes the details of the condition
+                      type: string
+                    reason:
+                      description: Reason is a short machine readable reason for
+                        the condition
+                      type: string
+                    status:
+                      description: Status of the condition (True or False)
+                      type: string
+                    type:
+                      description: Type of the condition
+                      type: string
+                  required:
+                  - status
+                  - type
+                  type: object
+                type: array
+              conflicts:
+                description: Conflicts lists overlapping allocations of different
+                  objects found by the consistency check
+                items:
+                  type: string
+                type: array
+              cooling:
+                description: Cooling are the released cidrs still in their release
+                  cooldown
+                items:
+                  properties:
+                    cidr:
+                      description: CIDR is the released cidr
+                      type: string
+                    until:
+                      description: Until is the end of the cooldown
+                      format: date-time
+                      type: string
+                  required:
+                  - cidr
+                  - until
+                  type: object
+                type: array
+              deletePending:
+                items:
+                  type: string
+                type: array
+              free:
+                description: Free summarizes the free addresses and the largest
+                  free block of all ip families
+                type: string
               message:
                 type: string
+              namespaces:
+                description: Namespaces describes the allocations of the range per
+                  namespace
+                items:
+                  properties:
+                    addresses:
+                      description: Addresses is the number of allocated addresses
+                      type: string
+                    namespace:
+                      description: Namespace is the namespace of the requests and
+                        sub ranges
+                      type: string
+                    requests:
+                      description: Requests is the number of requests and sub ranges
+                        with allocations
+                      type: integer
+                  required:
+                  - addresses
+                  - namespace
+                  - requests
+                  type: object
+                type: array
+              orphans:
+                description: Orphans lists allocated cidrs not used by any object
+                  found by the consistency check
+                items:
+                  type: string
+                type: array
+              reserved:
+                description: Reserved are the reserved cidrs excluded from allocation
+                items:
+                  type: string
+                type: array
               roundRobin:
                 items:
                   type: string
                 type: array
               state:
                 type: string
+              usage:
+                description: Usage describes the utilization of the range per
+                  ip family
+                items:
+                  properties:
+                    cooling:
+                      description: Cooling is the number of released addresses
+                        still in their release cooldown
+                      type: string
+                    family:
+                      description: Family is the ip family (IPv4 or IPv6)
+                      type: string
+                    fragmentation:
+                      description: Fragmentation is the ratio of free addresses
+                        not part of the largest free block
+                      type: string
+                    free:
+                      description: Free is the number of addresses available for
+                        allocation
+                      type: string
+                    largestFree:
+                      description: LargestFree is the netmask size of the largest
+                        allocatable block
+                      type: string
+                    reserved:
+                      description: Reserved is the number of reserved addresses
+                      type: string
+                    total:
+                      description: Total is the number of managed addresses
+                      type: string
+                    used:
+                      description: Used is the number of allocated addresses
+                      type: string
+                  required:
+                  - family
+                  - free
+                  - total
+                  - used
+                  type: object
+                type: array
             type: object
         required:
         - spec
@@ -133,6 +836,10 @@ spec:
     - jsonPath: .spec.ipam.name
       name: IPAM
       type: string
+    - jsonPath: .status.ipam
+      name: Selected
+      priority: 1
+      type: string
     - jsonPath: .spec.size
       name: Size
       type: integer
@@ -160,12 +867,30 @@ spec:
             type: object
           spec:
             properties:
+              contiguous:
+                description: Contiguous requests adjacent cidrs for a count larger
+                  than one
+                type: boolean
+              count:
+                description: Count is the number of cidrs of the requested size
+                  to allocate (default 1)
+                type: integer
               description:
                 type: string
+              ipFamilies:
+                description: IPFamilies requests an allocation for each given IP
+                  family (IPv4 or IPv6) of a dual-stack range
+                items:
+                  type: string
+                type: array
               ipam:
-                description: ObjectReference is is plain reference to an object of
-                  an implicitly determined type
+                description: IPAM is the range to allocate from, it is not used
+                  if the range is selected by IPAMs or IPAMSelector
                 properties:
+                  kind:
+                    description: Kind is the kind of the referenced range, IPAMRange
+                      (default) or ClusterIPAMRange
+                    type: string
                   name:
                     type: string
                   namespace:
@@ -173,17 +898,129 @@ spec:
                 required:
                 - name
                 type: object
+              ipamSelection:
+                description: 'IPAMSelection is the order the ranges matching the
+                  IPAMSelector are tried: Ordered (by name, default) or MostFree'
+                type: string
+              ipamSelector:
+                description: IPAMSelector selects the range to allocate from among
+                  the ranges in the namespace of the request
+                properties:
+                  matchExpressions:
+                    description: matchExpressions is a list of label selector requirements.
+                      The requirements are ANDed.
+                    items:
+                      description: A label selector requirement is a selector that
+                        contains values, a key, and an operator that relates the key
+                        and values.
+                      properties:
+                        key:
+                          description: key is the label key that the selector applies
+                            to.
+                          type: string
+                        operator:
+                          description: operator represents a key's relationship to
+                            a set of values. Valid operators are In, NotIn, Exists
+                            and DoesNotExist.
+                          type: string
+                        values:
+                          description: values is an array of string values. If the
+                            operator is In or NotIn, the values array must be non-empty.
+                            If the operator is Exists or DoesNotExist, the values
+                            array must be empty. This array is replaced during a
+                            strategic merge patch.
+                          items:
+                            type: string
+                          type: array
+                      required:
+                      - key
+                      - operator
+                      type: object
+                    type: array
+                  matchLabels:
+                    additionalProperties:
+                      type: string
+                    description: matchLabels is a map of {key,value} pairs. A single
+                      {key,value} in the matchLabels map is equivalent to an element
+                      of matchExpressions, whose key field is "key", the operator
+                      is "In", and the values array contains only "value". The requirements
+                      are ANDed.
+                    type: object
+                type: object
+              ipams:
+                description: IPAMs is a list of ranges tried in priority order until
+                  an allocation succeeds
+                items:
+                  description: IPAMReference refers to an IPAMRange or a ClusterIPAMRange.
+                  properties:
+                    kind:
+                      description: Kind is the kind of the referenced range, IPAMRange
+                        (default) or ClusterIPAMRange
+                      type: string
+                    name:
+                      type: string
+                    namespace:
+                      type: string
+                  required:
+                  - name
+                  type: object
+                type: array
+              leaseDuration:
+                description: LeaseDuration limits the lifetime of the allocation.
+                  The lease is renewed by changing the heartbeat annotation
+                type: string
+              output:
+                description: Output projects the allocation into a ConfigMap, Secret
+                  or any other object in the namespace of the request
+                properties:
+                  apiVersion:
+                    description: APIVersion of the target object (default v1)
+                    type: string
+                  kind:
+                    description: Kind of the target object, ConfigMap (default),
+                      Secret or any other kind
+                    type: string
+                  mapping:
+                    additionalProperties:
+                      type: string
+                    description: Mapping maps the data keys of a ConfigMap or Secret
+                      or the field paths of other objects to Go templates evaluated
+                      for the allocation
+                    type: object
+                  name:
+                    description: Name of the target object
+                    type: string
+                required:
+                - name
+                type: object
               request:
                 type: string
               size:
                 type: integer
-            required:
-            - ipam
             type: object
           status:
             properties:
               cidr:
                 type: string
+              cidrs:
+                description: CIDRs are all allocated cidrs, one per ip family or
+                  the requested count of cidrs
+                items:
+                  type: string
+                type: array
+              heartbeat:
+                description: Heartbeat is the value of the heartbeat annotation
+                  of the last renewal of the lease
+                type: string
+              ipam:
+                description: IPAM is the name of the range chosen from IPAMs or by
+                  the IPAMSelector
+                type: string
+              leaseExpiresAt:
+                description: LeaseExpiresAt is the time the allocation is released
+                  if the lease is not renewed
+                format: date-time
+                type: string
               message:
                 type: string
               state:
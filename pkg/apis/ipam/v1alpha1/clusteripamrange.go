@@ -0,0 +1,143 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gardener/controller-manager-library/pkg/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RangeObject is the common interface of the range kinds IPAMRange
+// and ClusterIPAMRange sharing the same specification and status.
+type RangeObject interface {
+	metav1.Object
+	runtime.Object
+
+	GetSpec() *IPAMRangeSpec
+	GetStatus() *IPAMRangeStatus
+	GetRanges() []string
+	GetState(bits int) []net.IP
+	GetCondition(t string) *IPAMRangeCondition
+	GetDeletePending() []*net.IPNet
+}
+
+var _ RangeObject = &IPAMRange{}
+var _ RangeObject = &ClusterIPAMRange{}
+
+// IPAMReference refers to an IPAMRange or a ClusterIPAMRange.
+type IPAMReference struct {
+	// Kind is the kind of the referenced range, IPAMRange (default)
+	// or ClusterIPAMRange
+	// +optional
+	Kind                  string `json:"kind,omitempty"`
+	types.ObjectReference `json:",inline"`
+}
+
+// IsCluster checks whether a ClusterIPAMRange is referenced.
+func (this *IPAMReference) IsCluster() bool {
+	return this.Kind == CLUSTERIPAMRANGE.Kind
+}
+
+// ParseIPAMReference parses a range name. A name of the form
+// <namespace>/<name> refers to an IPAMRange, a plain name to
+// a ClusterIPAMRange.
+func ParseIPAMReference(name string) (*IPAMReference, error) {
+	ref := &IPAMReference{}
+	if i := strings.Index(name, "/"); i >= 0 {
+		ref.Kind = IPAMRANGE.Kind
+		ref.Namespace = name[:i]
+		ref.Name = name[i+1:]
+	} else {
+		ref.Kind = CLUSTERIPAMRANGE.Kind
+		ref.Name = name
+	}
+	if ref.Name == "" || (!ref.IsCluster() && ref.Namespace == "") {
+		return nil, fmt.Errorf("invalid range name %q", name)
+	}
+	return ref, nil
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ClusterIPAMRangeList struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard list metadata
+	// More info: http://releases.k8s.io/HEAD/docs/devel/api-conventions.md#metadata
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterIPAMRange `json:"items"`
+}
+
+// +kubebuilder:storageversion
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,path=clusteripamranges,shortName=ciprange,singular=clusteripamrange
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name=Mode,JSONPath=".spec.mode",type=string
+// +kubebuilder:printcolumn:name=Parent,JSONPath=".spec.parent.name",type=string
+// +kubebuilder:printcolumn:name=Free,JSONPath=".status.free",type=string
+// +kubebuilder:printcolumn:name=STATE,JSONPath=".status.state",type=string
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterIPAMRange is a cluster wide range usable by requests and
+// ranges of all namespaces.
+type ClusterIPAMRange struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              IPAMRangeSpec `json:"spec"`
+	// +optional
+	Status IPAMRangeStatus `json:"status,omitempty"`
+}
+
+// GetSpec returns the specification of the range.
+func (this *ClusterIPAMRange) GetSpec() *IPAMRangeSpec {
+	return &this.Spec
+}
+
+// GetStatus returns the status of the range.
+func (this *ClusterIPAMRange) GetStatus() *IPAMRangeStatus {
+	return &this.Status
+}
+
+// GetRanges returns the ranges managed by the range object. For a range
+// with a parent these are the cidrs allocated from the parent range.
+func (this *ClusterIPAMRange) GetRanges() []string {
+	return this.Status.GetRanges(&this.Spec)
+}
+
+// GetState returns the round robin state for the IP family
+// with the given number of address bits.
+func (this *ClusterIPAMRange) GetState(bits int) []net.IP {
+	return this.Status.GetState(bits)
+}
+
+// GetCondition returns the condition of the given type or nil.
+func (this *ClusterIPAMRange) GetCondition(t string) *IPAMRangeCondition {
+	return this.Status.GetCondition(t)
+}
+
+func (this *ClusterIPAMRange) GetDeletePending() []*net.IPNet {
+	return this.Status.GetDeletePending()
+}
@@ -30,9 +30,32 @@ const STATE_READY = "Ready"
 const STATE_INVALID = "Invalid"
 const STATE_BUSY = "Busy"
 const STATE_DELETING = "Deleting"
+const STATE_SHRINKING = "Shrinking"
+const STATE_QUOTAEXCEEDED = "QuotaExceeded"
 
 const MODE_ROUNDROBIN = "RoundRobin"
 const MODE_FIRSTMATCH = "FirstMatch" // default
+const MODE_BESTFIT = "BestFit"
+const MODE_LASTMATCH = "LastMatch"
+const MODE_RANDOM = "Random"
+const MODE_HASHED = "Hashed"
+
+const CHECKPOINT_STATUS = "Status"
+const CHECKPOINT_CONFIGMAP = "ConfigMap"
+
+// CHECKPOINT_KEY is the key of the block state in a checkpoint config map.
+const CHECKPOINT_KEY = "blocks"
+
+const CONDITION_CHECKPOINT_CONSISTENT = "CheckpointConsistent"
+
+// ANNOTATION_GATEWAY is the annotation of a range describing the
+// gateway of its network, a comma separated list with one address
+// per ip family.
+const ANNOTATION_GATEWAY = "ipam.mandelsoft.org/gateway"
+
+// ANNOTATION_ROUTES is the annotation of a range describing the routes
+// of its network, a comma separated list of <cidr>[ via <gateway>].
+const ANNOTATION_ROUTES = "ipam.mandelsoft.org/routes"
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
@@ -49,6 +72,8 @@ type IPAMRangeList struct {
 // +kubebuilder:resource:scope=Namespaced,path=ipamranges,shortName=iprange,singular=ipamrange
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name=Mode,JSONPath=".spec.mode",type=string
+// +kubebuilder:printcolumn:name=Parent,JSONPath=".spec.parent.name",type=string
+// +kubebuilder:printcolumn:name=Free,JSONPath=".status.free",type=string
 // +kubebuilder:printcolumn:name=STATE,JSONPath=".status.state",type=string
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -63,23 +88,229 @@ type IPAMRange struct {
 
 type IPAMRangeSpec struct {
 	// +optional
-	Mode   string   `json:"mode,omitempty"`
-	Ranges []string `json:"ranges"`
+	Mode string `json:"mode,omitempty"`
+	// +optional
+	Ranges []string `json:"ranges,omitempty"`
+	// Reserved are addresses of the ranges, which must never be allocated,
+	// given as cidr, ip range or single ip
+	// +optional
+	Reserved []string `json:"reserved,omitempty"`
+
+	// +optional
+	ChunkSize int `json:"chunkSize,omitempty"`
+	// AvoidBoundaryAddresses is the netmask size (/<size>) of aligned
+	// blocks, whose first and last addresses are skipped for single
+	// address allocations
+	// +optional
+	AvoidBoundaryAddresses string `json:"avoidBoundaryAddresses,omitempty"`
+	// ReleaseCooldown is the time released cidrs are kept busy
+	// before they can be allocated again
+	// +optional
+	ReleaseCooldown *metav1.Duration `json:"releaseCooldown,omitempty"`
+
+	// Parent is an IPAMRange or ClusterIPAMRange the ranges of this
+	// range are allocated from
+	// +optional
+	Parent *IPAMReference `json:"parent,omitempty"`
+	// Request describes the allocation requested from the parent range
+	// +optional
+	Request string `json:"request,omitempty"`
+	// IPFamilies requests an allocation for each given IP family
+	// (IPv4 or IPv6) of a dual-stack parent range
+	// +optional
+	IPFamilies []string `json:"ipFamilies,omitempty"`
+
+	// Checkpoint enables checkpointing of the allocation state in the
+	// status of the range (Status) or in a config map (ConfigMap)
+	// +optional
+	Checkpoint string `json:"checkpoint,omitempty"`
+
+	// AllowedNamespaces restricts the namespaces of requests and sub ranges
+	// allowed to allocate from this range. Without restriction all
+	// namespaces are allowed.
+	// +optional
+	AllowedNamespaces *AllowedNamespaces `json:"allowedNamespaces,omitempty"`
+	// Quotas limit the allocations of requests and sub ranges per
+	// namespace. The first quota matching a namespace is used.
+	// +optional
+	Quotas []IPAMRangeQuota `json:"quotas,omitempty"`
+}
+
+type AllowedNamespaces struct {
+	// Names is a list of allowed namespaces
+	// +optional
+	Names []string `json:"names,omitempty"`
+	// Selector selects allowed namespaces by their labels
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
 
+type IPAMRangeQuota struct {
+	// Namespace is the namespace the quota applies to
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Selector selects the namespaces the quota applies to by their labels.
+	// The limits apply to every selected namespace separately.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Addresses is the maximum number of addresses allocated for a namespace
 	// +optional
-	ChunkSize int `json:"chunkSize, omitempty"`
+	Addresses string `json:"addresses,omitempty"`
+	// Requests is the maximum number of requests and sub ranges with
+	// allocations of a namespace
+	// +optional
+	Requests int `json:"requests,omitempty"`
 }
+
 type IPAMRangeStatus struct {
 	types.StandardObjectStatus `json:",inline"`
 	// + optional
 	RoundRobin []string `json:"roundRobin,omitempty"`
+	// + optional
+	DeletePending []string `json:"deletePending,omitempty"`
+	// CIDRs are the cidrs allocated from the parent range
+	// + optional
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Free summarizes the free addresses and the largest free block
+	// of all ip families
+	// + optional
+	Free string `json:"free,omitempty"`
+	// Usage describes the utilization of the range per ip family
+	// + optional
+	Usage []IPAMRangeUsage `json:"usage,omitempty"`
+	// Reserved are the reserved cidrs excluded from allocation
+	// + optional
+	Reserved []string `json:"reserved,omitempty"`
+	// Cooling are the released cidrs still in their release cooldown
+	// + optional
+	Cooling []IPAMRangeCooling `json:"cooling,omitempty"`
+	// Checkpoint is the checkpointed allocation state, if
+	// checkpointing into the status is enabled
+	// + optional
+	Checkpoint []string `json:"checkpoint,omitempty"`
+	// Conditions describe the result of consistency checks
+	// + optional
+	Conditions []IPAMRangeCondition `json:"conditions,omitempty"`
+	// Conflicts lists overlapping allocations of different objects
+	// found by the consistency check
+	// + optional
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Orphans lists allocated cidrs not used by any object
+	// found by the consistency check
+	// + optional
+	Orphans []string `json:"orphans,omitempty"`
+	// Namespaces describes the allocations of the range per namespace
+	// + optional
+	Namespaces []IPAMRangeNamespaceUsage `json:"namespaces,omitempty"`
 }
 
-func (this *IPAMRange) GetState() []net.IP {
+type IPAMRangeCondition struct {
+	// Type of the condition
+	Type string `json:"type"`
+	// Status of the condition (True or False)
+	Status string `json:"status"`
+	// Reason is a short machine readable reason for the condition
+	// + optional
+	Reason string `json:"reason,omitempty"`
+	// Message describes the details of the condition
+	// + optional
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the time the condition changed its status
+	// + optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+type IPAMRangeNamespaceUsage struct {
+	// Namespace is the namespace of the requests and sub ranges
+	Namespace string `json:"namespace"`
+	// Requests is the number of requests and sub ranges with allocations
+	Requests int `json:"requests"`
+	// Addresses is the number of allocated addresses
+	Addresses string `json:"addresses"`
+}
+
+type IPAMRangeCooling struct {
+	// CIDR is the released cidr
+	CIDR string `json:"cidr"`
+	// Until is the end of the cooldown
+	Until metav1.Time `json:"until"`
+}
+
+type IPAMRangeUsage struct {
+	// Family is the ip family (IPv4 or IPv6)
+	Family string `json:"family"`
+	// Total is the number of managed addresses
+	Total string `json:"total"`
+	// Used is the number of allocated addresses
+	Used string `json:"used"`
+	// Reserved is the number of reserved addresses
+	// + optional
+	Reserved string `json:"reserved,omitempty"`
+	// Cooling is the number of released addresses still in their
+	// release cooldown
+	// + optional
+	Cooling string `json:"cooling,omitempty"`
+	// Free is the number of addresses available for allocation
+	Free string `json:"free"`
+	// LargestFree is the netmask size of the largest allocatable block
+	// + optional
+	LargestFree string `json:"largestFree,omitempty"`
+	// Fragmentation is the ratio of free addresses not part of the
+	// largest free block
+	// + optional
+	Fragmentation string `json:"fragmentation,omitempty"`
+}
+
+// GetSpec returns the specification of the range.
+func (this *IPAMRange) GetSpec() *IPAMRangeSpec {
+	return &this.Spec
+}
+
+// GetStatus returns the status of the range.
+func (this *IPAMRange) GetStatus() *IPAMRangeStatus {
+	return &this.Status
+}
+
+// GetRanges returns the ranges managed by the range object. For a range
+// with a parent these are the cidrs allocated from the parent range.
+func (this *IPAMRange) GetRanges() []string {
+	return this.Status.GetRanges(&this.Spec)
+}
+
+// GetState returns the round robin state for the IP family
+// with the given number of address bits.
+func (this *IPAMRange) GetState(bits int) []net.IP {
+	return this.Status.GetState(bits)
+}
+
+// GetCondition returns the condition of the given type or nil.
+func (this *IPAMRange) GetCondition(t string) *IPAMRangeCondition {
+	return this.Status.GetCondition(t)
+}
+
+func (this *IPAMRange) GetDeletePending() []*net.IPNet {
+	return this.Status.GetDeletePending()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// GetRanges returns the ranges managed according to the given
+// specification. For a range with a parent these are the cidrs
+// allocated from the parent range.
+func (this *IPAMRangeStatus) GetRanges(spec *IPAMRangeSpec) []string {
+	if spec.Parent != nil {
+		return this.CIDRs
+	}
+	return spec.Ranges
+}
+
+// GetState returns the round robin state for the IP family
+// with the given number of address bits.
+func (this *IPAMRangeStatus) GetState(bits int) []net.IP {
 	state := []net.IP{}
-	for _, s := range this.Status.RoundRobin {
+	for _, s := range this.RoundRobin {
 		_, cidr, err := net.ParseCIDR(s)
-		if err != nil {
+		if err != nil || len(cidr.IP)*8 != bits {
 			continue
 		}
 		ones, _ := cidr.Mask.Size()
@@ -90,3 +321,25 @@ func (this *IPAMRange) GetState() []net.IP {
 	}
 	return state
 }
+
+// GetCondition returns the condition of the given type or nil.
+func (this *IPAMRangeStatus) GetCondition(t string) *IPAMRangeCondition {
+	for i := range this.Conditions {
+		if this.Conditions[i].Type == t {
+			return &this.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func (this *IPAMRangeStatus) GetDeletePending() []*net.IPNet {
+	pending := []*net.IPNet{}
+	for _, s := range this.DeletePending {
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil {
+			continue
+		}
+		pending = append(pending, cidr)
+	}
+	return pending
+}
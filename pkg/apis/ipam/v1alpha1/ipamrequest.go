@@ -25,6 +25,14 @@ const STATE_ERROR = "Error"
 
 //const STATE_INVALID = "Invalid"
 const STATE_UP = "Up"
+const STATE_EXPIRED = "Expired"
+
+// ANNOTATION_HEARTBEAT is the annotation used to renew the lease of
+// a request. Every change of its value renews the lease.
+const ANNOTATION_HEARTBEAT = "ipam.mandelsoft.org/heartbeat"
+
+const SELECTION_ORDERED = "Ordered" // default
+const SELECTION_MOSTFREE = "MostFree"
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
@@ -41,6 +49,7 @@ type IPAMRequestList struct {
 // +kubebuilder:resource:scope=Namespaced,path=ipamrequests,shortName=ipreq,singular=ipamrequest
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name=IPAM,JSONPath=".spec.ipam.name",type=string
+// +kubebuilder:printcolumn:name=Selected,JSONPath=".status.ipam",type=string,priority=1
 // +kubebuilder:printcolumn:name=Size,JSONPath=".spec.size",type=integer
 // +kubebuilder:printcolumn:name=STATE,JSONPath=".status.state",type=string
 // +kubebuilder:printcolumn:name=CIDR,JSONPath=".status.cidr",type=string
@@ -56,13 +65,66 @@ type IPAMRequest struct {
 }
 
 type IPAMRequestSpec struct {
-	IPAM types.ObjectReference `json:"ipam"`
+	// IPAM is the range to allocate from, it is not used if the
+	// range is selected by IPAMs or IPAMSelector
+	// +optional
+	IPAM IPAMReference `json:"ipam"`
+	// IPAMs is a list of ranges tried in priority order until an
+	// allocation succeeds
+	// +optional
+	IPAMs []IPAMReference `json:"ipams,omitempty"`
+	// IPAMSelector selects the range to allocate from among the
+	// ranges in the namespace of the request
+	// +optional
+	IPAMSelector *metav1.LabelSelector `json:"ipamSelector,omitempty"`
+	// IPAMSelection is the order the ranges matching the IPAMSelector
+	// are tried: Ordered (by name, default) or MostFree
+	// +optional
+	IPAMSelection string `json:"ipamSelection,omitempty"`
 	// +optional
 	Size int `json:"size,omitempty"`
 	// +optional
 	Description string `json:"description,omitempty"`
 	// +optional
-	Request string `json:"request,omitempty"` // not implemented yet - do not use
+	Request string `json:"request,omitempty"`
+	// IPFamilies requests an allocation for each given IP family
+	// (IPv4 or IPv6) of a dual-stack range
+	// +optional
+	IPFamilies []string `json:"ipFamilies,omitempty"`
+	// LeaseDuration limits the lifetime of the allocation. The lease
+	// is renewed by changing the heartbeat annotation
+	// +optional
+	LeaseDuration *metav1.Duration `json:"leaseDuration,omitempty"`
+	// Count is the number of cidrs of the requested size to allocate
+	// (default 1)
+	// +optional
+	Count int `json:"count,omitempty"`
+	// Contiguous requests adjacent cidrs for a count larger than one
+	// +optional
+	Contiguous bool `json:"contiguous,omitempty"`
+	// Output projects the allocation into a ConfigMap, Secret or
+	// any other object in the namespace of the request
+	// +optional
+	Output *IPAMOutput `json:"output,omitempty"`
+}
+
+// IPAMOutput describes the target object the allocated cidrs
+// are projected to.
+type IPAMOutput struct {
+	// APIVersion of the target object (default v1)
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Kind of the target object, ConfigMap (default), Secret or
+	// any other kind
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Name of the target object
+	Name string `json:"name"`
+	// Mapping maps the data keys of a ConfigMap or Secret or
+	// the field paths of other objects to Go templates evaluated
+	// for the allocation
+	// +optional
+	Mapping map[string]string `json:"mapping,omitempty"`
 }
 
 type IPAMRequestStatus struct {
@@ -70,4 +132,57 @@ type IPAMRequestStatus struct {
 
 	// +optional
 	CIDR string `json:"cidr,omitempty"`
+	// CIDRs are all allocated cidrs, one per ip family or
+	// the requested count of cidrs
+	// +optional
+	CIDRs []string `json:"cidrs,omitempty"`
+	// IPAM is the name of the range chosen from IPAMs or by the
+	// IPAMSelector
+	// +optional
+	IPAM string `json:"ipam,omitempty"`
+	// LeaseExpiresAt is the time the allocation is released if the
+	// lease is not renewed
+	// +optional
+	LeaseExpiresAt *metav1.Time `json:"leaseExpiresAt,omitempty"`
+	// Heartbeat is the value of the heartbeat annotation of the
+	// last renewal of the lease
+	// +optional
+	Heartbeat string `json:"heartbeat,omitempty"`
+}
+
+// GetAPIVersion returns the api version of the target object.
+func (this *IPAMOutput) GetAPIVersion() string {
+	if this.APIVersion == "" {
+		return "v1"
+	}
+	return this.APIVersion
+}
+
+// GetKind returns the kind of the target object.
+func (this *IPAMOutput) GetKind() string {
+	if this.Kind == "" {
+		return "ConfigMap"
+	}
+	return this.Kind
+}
+
+// IsData checks whether the target object is a ConfigMap or Secret,
+// whose mapping is based on data keys instead of field paths.
+func (this *IPAMOutput) IsData() bool {
+	if this.GetAPIVersion() != "v1" {
+		return false
+	}
+	return this.GetKind() == "ConfigMap" || this.GetKind() == "Secret"
+}
+
+// GetCIDRs returns all allocated cidrs. Objects created before the
+// introduction of the cidrs field just report a single cidr.
+func (this *IPAMRequest) GetCIDRs() []string {
+	if len(this.Status.CIDRs) > 0 {
+		return this.Status.CIDRs
+	}
+	if this.Status.CIDR != "" {
+		return []string{this.Status.CIDR}
+	}
+	return nil
 }
@@ -32,6 +32,7 @@ const (
 
 var IPAMRANGE = resources.NewGroupKind(GroupName, "IPAMRange")
 var IPAMREQUEST = resources.NewGroupKind(GroupName, "IPAMRequest")
+var CLUSTERIPAMRANGE = resources.NewGroupKind(GroupName, "ClusterIPAMRange")
 
 // SchemeGroupVersion is group version used to register these objects
 var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
@@ -58,6 +59,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&IPAMRangeList{},
 		&IPAMRequest{},
 		&IPAMRequestList{},
+		&ClusterIPAMRange{},
+		&ClusterIPAMRangeList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -21,9 +21,120 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AllowedNamespaces) DeepCopyInto(out *AllowedNamespaces) {
+	*out = *in
+	if in.Names != nil {
+		in, out := &in.Names, &out.Names
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AllowedNamespaces.
+func (in *AllowedNamespaces) DeepCopy() *AllowedNamespaces {
+	if in == nil {
+		return nil
+	}
+	out := new(AllowedNamespaces)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterIPAMRange) DeepCopyInto(out *ClusterIPAMRange) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIPAMRange.
+func (in *ClusterIPAMRange) DeepCopy() *ClusterIPAMRange {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterIPAMRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterIPAMRange) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterIPAMRangeList) DeepCopyInto(out *ClusterIPAMRangeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterIPAMRange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIPAMRangeList.
+func (in *ClusterIPAMRangeList) DeepCopy() *ClusterIPAMRangeList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterIPAMRangeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterIPAMRangeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAMOutput) DeepCopyInto(out *IPAMOutput) {
+	*out = *in
+	if in.Mapping != nil {
+		in, out := &in.Mapping, &out.Mapping
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAMOutput.
+func (in *IPAMOutput) DeepCopy() *IPAMOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAMOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAMRange) DeepCopyInto(out *IPAMRange) {
 	*out = *in
@@ -52,6 +163,40 @@ func (in *IPAMRange) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAMRangeCondition) DeepCopyInto(out *IPAMRangeCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAMRangeCondition.
+func (in *IPAMRangeCondition) DeepCopy() *IPAMRangeCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAMRangeCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAMRangeCooling) DeepCopyInto(out *IPAMRangeCooling) {
+	*out = *in
+	in.Until.DeepCopyInto(&out.Until)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAMRangeCooling.
+func (in *IPAMRangeCooling) DeepCopy() *IPAMRangeCooling {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAMRangeCooling)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAMRangeList) DeepCopyInto(out *IPAMRangeList) {
 	*out = *in
@@ -85,6 +230,43 @@ func (in *IPAMRangeList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAMRangeNamespaceUsage) DeepCopyInto(out *IPAMRangeNamespaceUsage) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAMRangeNamespaceUsage.
+func (in *IPAMRangeNamespaceUsage) DeepCopy() *IPAMRangeNamespaceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAMRangeNamespaceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAMRangeQuota) DeepCopyInto(out *IPAMRangeQuota) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAMRangeQuota.
+func (in *IPAMRangeQuota) DeepCopy() *IPAMRangeQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAMRangeQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAMRangeSpec) DeepCopyInto(out *IPAMRangeSpec) {
 	*out = *in
@@ -93,6 +275,38 @@ func (in *IPAMRangeSpec) DeepCopyInto(out *IPAMRangeSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Reserved != nil {
+		in, out := &in.Reserved, &out.Reserved
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReleaseCooldown != nil {
+		in, out := &in.ReleaseCooldown, &out.ReleaseCooldown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Parent != nil {
+		in, out := &in.Parent, &out.Parent
+		*out = new(IPAMReference)
+		**out = **in
+	}
+	if in.IPFamilies != nil {
+		in, out := &in.IPFamilies, &out.IPFamilies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(AllowedNamespaces)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Quotas != nil {
+		in, out := &in.Quotas, &out.Quotas
+		*out = make([]IPAMRangeQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -115,6 +329,60 @@ func (in *IPAMRangeStatus) DeepCopyInto(out *IPAMRangeStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DeletePending != nil {
+		in, out := &in.DeletePending, &out.DeletePending
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Usage != nil {
+		in, out := &in.Usage, &out.Usage
+		*out = make([]IPAMRangeUsage, len(*in))
+		copy(*out, *in)
+	}
+	if in.Reserved != nil {
+		in, out := &in.Reserved, &out.Reserved
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Cooling != nil {
+		in, out := &in.Cooling, &out.Cooling
+		*out = make([]IPAMRangeCooling, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Checkpoint != nil {
+		in, out := &in.Checkpoint, &out.Checkpoint
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]IPAMRangeCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conflicts != nil {
+		in, out := &in.Conflicts, &out.Conflicts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Orphans != nil {
+		in, out := &in.Orphans, &out.Orphans
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]IPAMRangeNamespaceUsage, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -128,13 +396,46 @@ func (in *IPAMRangeStatus) DeepCopy() *IPAMRangeStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAMRangeUsage) DeepCopyInto(out *IPAMRangeUsage) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAMRangeUsage.
+func (in *IPAMRangeUsage) DeepCopy() *IPAMRangeUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAMRangeUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAMReference) DeepCopyInto(out *IPAMReference) {
+	*out = *in
+	in.ObjectReference.DeepCopyInto(&out.ObjectReference)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAMReference.
+func (in *IPAMReference) DeepCopy() *IPAMReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAMReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAMRequest) DeepCopyInto(out *IPAMRequest) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -192,7 +493,32 @@ func (in *IPAMRequestList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAMRequestSpec) DeepCopyInto(out *IPAMRequestSpec) {
 	*out = *in
-	in.IPAM.DeepCopyInto(&out.IPAM)
+	out.IPAM = in.IPAM
+	if in.IPAMs != nil {
+		in, out := &in.IPAMs, &out.IPAMs
+		*out = make([]IPAMReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.IPAMSelector != nil {
+		in, out := &in.IPAMSelector, &out.IPAMSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IPFamilies != nil {
+		in, out := &in.IPFamilies, &out.IPFamilies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LeaseDuration != nil {
+		in, out := &in.LeaseDuration, &out.LeaseDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Output != nil {
+		in, out := &in.Output, &out.Output
+		*out = new(IPAMOutput)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -210,6 +536,15 @@ func (in *IPAMRequestSpec) DeepCopy() *IPAMRequestSpec {
 func (in *IPAMRequestStatus) DeepCopyInto(out *IPAMRequestStatus) {
 	*out = *in
 	in.StandardObjectStatus.DeepCopyInto(&out.StandardObjectStatus)
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LeaseExpiresAt != nil {
+		in, out := &in.LeaseExpiresAt, &out.LeaseExpiresAt
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
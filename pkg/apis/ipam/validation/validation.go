@@ -0,0 +1,362 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package validation
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"text/template"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// ValidateIPAMRange checks the specification of an IPAMRange or
+// ClusterIPAMRange object.
+// It is used by the controller and the validating webhook.
+func ValidateIPAMRange(r api.RangeObject) error {
+	spec := r.GetSpec()
+	_, cluster := r.(*api.ClusterIPAMRange)
+
+	switch spec.Mode {
+	case "", api.MODE_FIRSTMATCH, api.MODE_ROUNDROBIN, api.MODE_HASHED:
+	default:
+		if ipam.GetStrategy(spec.Mode) == nil {
+			modes := append([]string{api.MODE_FIRSTMATCH, api.MODE_ROUNDROBIN, api.MODE_HASHED}, ipam.Strategies()...)
+			return fmt.Errorf("invalid mode %q: use one of %s", spec.Mode, strings.Join(modes, ", "))
+		}
+	}
+
+	switch spec.Checkpoint {
+	case "", api.CHECKPOINT_STATUS, api.CHECKPOINT_CONFIGMAP:
+	default:
+		return fmt.Errorf("invalid checkpoint %q: use %s or %s", spec.Checkpoint, api.CHECKPOINT_STATUS, api.CHECKPOINT_CONFIGMAP)
+	}
+	if cluster && spec.Checkpoint == api.CHECKPOINT_CONFIGMAP {
+		return fmt.Errorf("checkpoint %s not supported for cluster ranges", api.CHECKPOINT_CONFIGMAP)
+	}
+
+	if spec.ReleaseCooldown != nil && spec.ReleaseCooldown.Duration < 0 {
+		return fmt.Errorf("invalid release cooldown %s", spec.ReleaseCooldown.Duration)
+	}
+
+	if spec.ChunkSize < 0 {
+		return fmt.Errorf("invalid chunk size %d", spec.ChunkSize)
+	}
+
+	boundary := 0
+	if spec.AvoidBoundaryAddresses != "" {
+		b, err := ipam.ParseBoundary(spec.AvoidBoundaryAddresses)
+		if err != nil {
+			return err
+		}
+		boundary = b
+	}
+
+	if _, err := ipam.ParseIPRanges(spec.Reserved...); err != nil {
+		return fmt.Errorf("invalid reserved addresses: %s", err)
+	}
+
+	if a := spec.AllowedNamespaces; a != nil && a.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(a.Selector); err != nil {
+			return fmt.Errorf("invalid allowedNamespaces selector: %s", err)
+		}
+	}
+
+	for i, q := range spec.Quotas {
+		if err := validateQuota(&q); err != nil {
+			return fmt.Errorf("invalid quota %d: %s", i, err)
+		}
+	}
+
+	if spec.Parent != nil {
+		if spec.Parent.Name == "" {
+			return fmt.Errorf("parent IPAMRange object not specified")
+		}
+		if err := validateReference(spec.Parent); err != nil {
+			return fmt.Errorf("invalid parent: %s", err)
+		}
+		if cluster && !spec.Parent.IsCluster() {
+			return fmt.Errorf("parent of cluster range must be a %s", api.CLUSTERIPAMRANGE.Kind)
+		}
+		if len(spec.Ranges) > 0 {
+			return fmt.Errorf("ranges cannot be specified for a range with a parent")
+		}
+		if spec.ChunkSize > net.IPv6len*8 {
+			return fmt.Errorf("invalid chunk size %d", spec.ChunkSize)
+		}
+		return validateRequest(spec.Request, spec.IPFamilies)
+	}
+	if spec.Request != "" || len(spec.IPFamilies) > 0 {
+		return fmt.Errorf("request and ipFamilies require a parent range")
+	}
+
+	ranges, err := ipam.ParseIPRanges(spec.Ranges...)
+	if err != nil {
+		return err
+	}
+	families := ranges.Families()
+	for _, f := range families {
+		if bits := ipam.FamilyBits(f); boundary > bits-2 {
+			return fmt.Errorf("boundary size %d invalid for %d bit network", boundary, bits)
+		}
+	}
+	if len(families) > 1 && spec.ChunkSize > 0 {
+		return fmt.Errorf("chunk size not supported for dual-stack ranges")
+	}
+	if len(families) == 1 && spec.ChunkSize > 0 {
+		bits := ipam.FamilyBits(families[0])
+		if bits < spec.ChunkSize {
+			return fmt.Errorf("chunk size %d too large: network %d", spec.ChunkSize, bits)
+		}
+		cidrs, err := ipam.Includes(ranges...)
+		if err != nil {
+			return err
+		}
+		for _, c := range cidrs {
+			if ipam.CIDRNetMaskSize(c) <= spec.ChunkSize {
+				return nil
+			}
+		}
+		return fmt.Errorf("chunk size %d does not fit into any range", spec.ChunkSize)
+	}
+	return nil
+}
+
+// ValidateIPAMRangeUpdate checks the modification of an IPAMRange or
+// ClusterIPAMRange object.
+// The parent related fields cannot be changed once an allocation has been
+// done in the parent range.
+func ValidateIPAMRangeUpdate(old, new api.RangeObject) error {
+	if err := ValidateIPAMRange(new); err != nil {
+		return err
+	}
+	ospec, nspec := old.GetSpec(), new.GetSpec()
+	if cidrs := old.GetStatus().CIDRs; len(cidrs) > 0 {
+		if !reflect.DeepEqual(ospec.Parent, nspec.Parent) ||
+			ospec.Request != nspec.Request ||
+			!reflect.DeepEqual(ospec.IPFamilies, nspec.IPFamilies) {
+			return fmt.Errorf("parent, request and ipFamilies of range with allocated cidrs %s must not be modified",
+				strings.Join(cidrs, ", "))
+		}
+	}
+	return nil
+}
+
+// validateQuota checks a namespace quota of a range.
+func validateQuota(q *api.IPAMRangeQuota) error {
+	if (q.Namespace == "") == (q.Selector == nil) {
+		return fmt.Errorf("either namespace or selector must be specified")
+	}
+	if q.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(q.Selector); err != nil {
+			return fmt.Errorf("invalid selector: %s", err)
+		}
+	}
+	if q.Addresses == "" && q.Requests == 0 {
+		return fmt.Errorf("addresses or requests required")
+	}
+	if q.Addresses != "" {
+		n, err := ipam.ParseInt(q.Addresses)
+		if err != nil || n.Sgn() < 0 {
+			return fmt.Errorf("invalid number of addresses %q", q.Addresses)
+		}
+	}
+	if q.Requests < 0 {
+		return fmt.Errorf("invalid number of requests %d", q.Requests)
+	}
+	return nil
+}
+
+// validateReference checks the kind of a range reference.
+func validateReference(ref *api.IPAMReference) error {
+	switch ref.Kind {
+	case "", api.IPAMRANGE.Kind:
+	case api.CLUSTERIPAMRANGE.Kind:
+		if ref.Namespace != "" {
+			return fmt.Errorf("namespace not possible for %s %s", ref.Kind, ref.Name)
+		}
+	default:
+		return fmt.Errorf("invalid kind %q: use %s or %s", ref.Kind, api.IPAMRANGE.Kind, api.CLUSTERIPAMRANGE.Kind)
+	}
+	return nil
+}
+
+// ValidateIPAMRequest checks the specification of an IPAMRequest object.
+// It is used by the controller and the validating webhook.
+func ValidateIPAMRequest(r *api.IPAMRequest) error {
+	set := 0
+	for _, b := range []bool{r.Spec.IPAM.Name != "", len(r.Spec.IPAMs) > 0, r.Spec.IPAMSelector != nil} {
+		if b {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return fmt.Errorf("IPAMRange object not specified")
+	case set > 1:
+		return fmt.Errorf("only one of ipam, ipams and ipamSelector may be used")
+	}
+	if r.Spec.IPAM.Name != "" {
+		if err := validateReference(&r.Spec.IPAM); err != nil {
+			return fmt.Errorf("invalid ipam: %s", err)
+		}
+	}
+	for i := range r.Spec.IPAMs {
+		ref := &r.Spec.IPAMs[i]
+		if ref.Name == "" {
+			return fmt.Errorf("IPAMRange object not specified for ipams entry %d", i)
+		}
+		if err := validateReference(ref); err != nil {
+			return fmt.Errorf("invalid ipams entry %d: %s", i, err)
+		}
+	}
+	if r.Spec.IPAMSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(r.Spec.IPAMSelector); err != nil {
+			return fmt.Errorf("invalid ipamSelector: %s", err)
+		}
+	}
+	switch r.Spec.IPAMSelection {
+	case "", api.SELECTION_ORDERED, api.SELECTION_MOSTFREE:
+	default:
+		return fmt.Errorf("invalid ipamSelection %q: use %s or %s", r.Spec.IPAMSelection, api.SELECTION_ORDERED, api.SELECTION_MOSTFREE)
+	}
+	if r.Spec.Size < 0 || r.Spec.Size > net.IPv6len*8 {
+		return fmt.Errorf("invalid size %d", r.Spec.Size)
+	}
+	if r.Spec.LeaseDuration != nil && r.Spec.LeaseDuration.Duration <= 0 {
+		return fmt.Errorf("invalid lease duration %s", r.Spec.LeaseDuration.Duration)
+	}
+	if len(r.Spec.IPFamilies) > 1 && r.Spec.Size > 0 {
+		return fmt.Errorf("size cannot be used for multiple ip families: use a request based on a host mask size")
+	}
+	if r.Spec.Count < 0 {
+		return fmt.Errorf("invalid count %d", r.Spec.Count)
+	}
+	if r.Spec.Count > 1 {
+		if len(r.Spec.IPFamilies) > 1 {
+			return fmt.Errorf("count cannot be used for multiple ip families")
+		}
+		if r.Spec.Request != "" {
+			return fmt.Errorf("count cannot be used together with a request: use size")
+		}
+	}
+	if r.Spec.Output != nil {
+		if err := validateOutput(r.Spec.Output); err != nil {
+			return fmt.Errorf("invalid output: %s", err)
+		}
+	}
+	return validateRequest(r.Spec.Request, r.Spec.IPFamilies)
+}
+
+// validateOutput checks the target object and the mapping of an output.
+func validateOutput(o *api.IPAMOutput) error {
+	if o.Name == "" {
+		return fmt.Errorf("name of target object not specified")
+	}
+	if errs := k8svalidation.IsDNS1123Subdomain(o.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q: %s", o.Name, strings.Join(errs, ", "))
+	}
+	if _, err := schema.ParseGroupVersion(o.GetAPIVersion()); err != nil {
+		return fmt.Errorf("invalid apiVersion %q: %s", o.APIVersion, err)
+	}
+	if !o.IsData() && len(o.Mapping) == 0 {
+		return fmt.Errorf("mapping required for %s", o.GetKind())
+	}
+	for k, v := range o.Mapping {
+		if o.IsData() {
+			if errs := k8svalidation.IsConfigMapKey(k); len(errs) > 0 {
+				return fmt.Errorf("invalid key %q: %s", k, strings.Join(errs, ", "))
+			}
+		} else {
+			path := strings.Split(k, ".")
+			for _, e := range path {
+				if e == "" {
+					return fmt.Errorf("invalid field path %q", k)
+				}
+			}
+			switch path[0] {
+			case "apiVersion", "kind", "metadata", "status":
+				return fmt.Errorf("field path %q not possible", k)
+			}
+		}
+		if _, err := template.New(k).Option("missingkey=error").Parse(v); err != nil {
+			return fmt.Errorf("invalid template for %q: %s", k, err)
+		}
+	}
+	return nil
+}
+
+// validateRequest checks a request spec and the requested ip families.
+func validateRequest(request string, families []string) error {
+	for i, f := range families {
+		if err := ipam.ValidateFamily(f); err != nil {
+			return err
+		}
+		for _, o := range families[:i] {
+			if o == f {
+				return fmt.Errorf("duplicate ip family %q", f)
+			}
+		}
+	}
+	if request != "" {
+		spec, err := ipam.ParseRequestSpec(strings.TrimSpace(request))
+		if err != nil {
+			return fmt.Errorf("invalid request %q: %s", request, err)
+		}
+		if spec.IsCIDR() && len(families) > 0 {
+			if len(families) > 1 {
+				return fmt.Errorf("request %q cannot be used for multiple ip families", request)
+			}
+			if f := ipam.BitsFamily(spec.Bits()); f != families[0] {
+				return fmt.Errorf("request %q does not match ip family %s", request, families[0])
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateIPAMRequestUpdate checks the modification of an IPAMRequest object.
+// Apart from the description and the lease duration the specification of
+// a request must not be changed once an allocation has been done for it.
+func ValidateIPAMRequestUpdate(old, new *api.IPAMRequest) error {
+	if err := ValidateIPAMRequest(new); err != nil {
+		return err
+	}
+	if old.Status.CIDR != "" {
+		// the description is informational only and may always be changed,
+		// a changed lease duration is used for the next renewal
+		ospec := old.Spec
+		nspec := new.Spec
+		ospec.Description = ""
+		nspec.Description = ""
+		ospec.LeaseDuration = nil
+		nspec.LeaseDuration = nil
+		if !reflect.DeepEqual(ospec, nspec) {
+			return fmt.Errorf("specification of request with allocated cidr %s must not be modified", old.Status.CIDR)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+/*
+Copyright (c) 2020 Mandelsoft. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"time"
+
+	v1alpha1 "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	scheme "github.com/mandelsoft/kubipam/pkg/client/ipam/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// ClusterIPAMRangesGetter has a method to return a ClusterIPAMRangeInterface.
+// A group's client should implement this interface.
+type ClusterIPAMRangesGetter interface {
+	ClusterIPAMRanges() ClusterIPAMRangeInterface
+}
+
+// ClusterIPAMRangeInterface has methods to work with ClusterIPAMRange resources.
+type ClusterIPAMRangeInterface interface {
+	Create(*v1alpha1.ClusterIPAMRange) (*v1alpha1.ClusterIPAMRange, error)
+	Update(*v1alpha1.ClusterIPAMRange) (*v1alpha1.ClusterIPAMRange, error)
+	UpdateStatus(*v1alpha1.ClusterIPAMRange) (*v1alpha1.ClusterIPAMRange, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.ClusterIPAMRange, error)
+	List(opts v1.ListOptions) (*v1alpha1.ClusterIPAMRangeList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.ClusterIPAMRange, err error)
+	ClusterIPAMRangeExpansion
+}
+
+// clusterIPAMRanges implements ClusterIPAMRangeInterface
+type clusterIPAMRanges struct {
+	client rest.Interface
+}
+
+// newClusterIPAMRanges returns a ClusterIPAMRanges
+func newClusterIPAMRanges(c *IpamV1alpha1Client) *clusterIPAMRanges {
+	return &clusterIPAMRanges{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the clusterIPAMRange, and returns the corresponding clusterIPAMRange object, and an error if there is any.
+func (c *clusterIPAMRanges) Get(name string, options v1.GetOptions) (result *v1alpha1.ClusterIPAMRange, err error) {
+	result = &v1alpha1.ClusterIPAMRange{}
+	err = c.client.Get().
+		Resource("clusteripamranges").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of ClusterIPAMRanges that match those selectors.
+func (c *clusterIPAMRanges) List(opts v1.ListOptions) (result *v1alpha1.ClusterIPAMRangeList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.ClusterIPAMRangeList{}
+	err = c.client.Get().
+		Resource("clusteripamranges").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested clusterIPAMRanges.
+func (c *clusterIPAMRanges) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Resource("clusteripamranges").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch()
+}
+
+// Create takes the representation of a clusterIPAMRange and creates it.  Returns the server's representation of the clusterIPAMRange, and an error, if there is any.
+func (c *clusterIPAMRanges) Create(clusterIPAMRange *v1alpha1.ClusterIPAMRange) (result *v1alpha1.ClusterIPAMRange, err error) {
+	result = &v1alpha1.ClusterIPAMRange{}
+	err = c.client.Post().
+		Resource("clusteripamranges").
+		Body(clusterIPAMRange).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a clusterIPAMRange and updates it. Returns the server's representation of the clusterIPAMRange, and an error, if there is any.
+func (c *clusterIPAMRanges) Update(clusterIPAMRange *v1alpha1.ClusterIPAMRange) (result *v1alpha1.ClusterIPAMRange, err error) {
+	result = &v1alpha1.ClusterIPAMRange{}
+	err = c.client.Put().
+		Resource("clusteripamranges").
+		Name(clusterIPAMRange.Name).
+		Body(clusterIPAMRange).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *clusterIPAMRanges) UpdateStatus(clusterIPAMRange *v1alpha1.ClusterIPAMRange) (result *v1alpha1.ClusterIPAMRange, err error) {
+	result = &v1alpha1.ClusterIPAMRange{}
+	err = c.client.Put().
+		Resource("clusteripamranges").
+		Name(clusterIPAMRange.Name).
+		SubResource("status").
+		Body(clusterIPAMRange).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the clusterIPAMRange and deletes it. Returns an error if one occurs.
+func (c *clusterIPAMRanges) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("clusteripamranges").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *clusterIPAMRanges) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	var timeout time.Duration
+	if listOptions.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Resource("clusteripamranges").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched clusterIPAMRange.
+func (c *clusterIPAMRanges) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.ClusterIPAMRange, err error) {
+	result = &v1alpha1.ClusterIPAMRange{}
+	err = c.client.Patch(pt).
+		Resource("clusteripamranges").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,131 @@
+/*
+Copyright (c) 2020 Mandelsoft. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1alpha1 "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeClusterIPAMRanges implements ClusterIPAMRangeInterface
+type FakeClusterIPAMRanges struct {
+	Fake *FakeIpamV1alpha1
+}
+
+var clusteripamrangesResource = schema.GroupVersionResource{Group: "ipam.mandelsoft.org", Version: "v1alpha1", Resource: "clusteripamranges"}
+
+var clusteripamrangesKind = schema.GroupVersionKind{Group: "ipam.mandelsoft.org", Version: "v1alpha1", Kind: "ClusterIPAMRange"}
+
+// Get takes name of the clusterIPAMRange, and returns the corresponding clusterIPAMRange object, and an error if there is any.
+func (c *FakeClusterIPAMRanges) Get(name string, options v1.GetOptions) (result *v1alpha1.ClusterIPAMRange, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(clusteripamrangesResource, name), &v1alpha1.ClusterIPAMRange{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterIPAMRange), err
+}
+
+// List takes label and field selectors, and returns the list of ClusterIPAMRanges that match those selectors.
+func (c *FakeClusterIPAMRanges) List(opts v1.ListOptions) (result *v1alpha1.ClusterIPAMRangeList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(clusteripamrangesResource, clusteripamrangesKind, opts), &v1alpha1.ClusterIPAMRangeList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.ClusterIPAMRangeList{ListMeta: obj.(*v1alpha1.ClusterIPAMRangeList).ListMeta}
+	for _, item := range obj.(*v1alpha1.ClusterIPAMRangeList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested clusterIPAMRanges.
+func (c *FakeClusterIPAMRanges) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(clusteripamrangesResource, opts))
+}
+
+// Create takes the representation of a clusterIPAMRange and creates it.  Returns the server's representation of the clusterIPAMRange, and an error, if there is any.
+func (c *FakeClusterIPAMRanges) Create(clusterIPAMRange *v1alpha1.ClusterIPAMRange) (result *v1alpha1.ClusterIPAMRange, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(clusteripamrangesResource, clusterIPAMRange), &v1alpha1.ClusterIPAMRange{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterIPAMRange), err
+}
+
+// Update takes the representation of a clusterIPAMRange and updates it. Returns the server's representation of the clusterIPAMRange, and an error, if there is any.
+func (c *FakeClusterIPAMRanges) Update(clusterIPAMRange *v1alpha1.ClusterIPAMRange) (result *v1alpha1.ClusterIPAMRange, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(clusteripamrangesResource, clusterIPAMRange), &v1alpha1.ClusterIPAMRange{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterIPAMRange), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeClusterIPAMRanges) UpdateStatus(clusterIPAMRange *v1alpha1.ClusterIPAMRange) (*v1alpha1.ClusterIPAMRange, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateSubresourceAction(clusteripamrangesResource, "status", clusterIPAMRange), &v1alpha1.ClusterIPAMRange{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterIPAMRange), err
+}
+
+// Delete takes name of the clusterIPAMRange and deletes it. Returns an error if one occurs.
+func (c *FakeClusterIPAMRanges) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(clusteripamrangesResource, name), &v1alpha1.ClusterIPAMRange{})
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeClusterIPAMRanges) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(clusteripamrangesResource, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.ClusterIPAMRangeList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched clusterIPAMRange.
+func (c *FakeClusterIPAMRanges) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.ClusterIPAMRange, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(clusteripamrangesResource, name, pt, data, subresources...), &v1alpha1.ClusterIPAMRange{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterIPAMRange), err
+}
@@ -28,6 +28,10 @@ type FakeIpamV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeIpamV1alpha1) ClusterIPAMRanges() v1alpha1.ClusterIPAMRangeInterface {
+	return &FakeClusterIPAMRanges{c}
+}
+
 func (c *FakeIpamV1alpha1) IPAMRanges(namespace string) v1alpha1.IPAMRangeInterface {
 	return &FakeIPAMRanges{c, namespace}
 }
@@ -18,6 +18,8 @@ limitations under the License.
 
 package v1alpha1
 
+type ClusterIPAMRangeExpansion interface{}
+
 type IPAMRangeExpansion interface{}
 
 type IPAMRequestExpansion interface{}
@@ -26,6 +26,7 @@ import (
 
 type IpamV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	ClusterIPAMRangesGetter
 	IPAMRangesGetter
 	IPAMRequestsGetter
 }
@@ -35,6 +36,10 @@ type IpamV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *IpamV1alpha1Client) ClusterIPAMRanges() ClusterIPAMRangeInterface {
+	return newClusterIPAMRanges(c)
+}
+
 func (c *IpamV1alpha1Client) IPAMRanges(namespace string) IPAMRangeInterface {
 	return newIPAMRanges(c, namespace)
 }
@@ -53,6 +53,8 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=ipam.mandelsoft.org, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("clusteripamranges"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Ipam().V1alpha1().ClusterIPAMRanges().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("ipamranges"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Ipam().V1alpha1().IPAMRanges().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("ipamrequests"):
@@ -24,6 +24,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// ClusterIPAMRanges returns a ClusterIPAMRangeInformer.
+	ClusterIPAMRanges() ClusterIPAMRangeInformer
 	// IPAMRanges returns a IPAMRangeInformer.
 	IPAMRanges() IPAMRangeInformer
 	// IPAMRequests returns a IPAMRequestInformer.
@@ -41,6 +43,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// ClusterIPAMRanges returns a ClusterIPAMRangeInformer.
+func (v *version) ClusterIPAMRanges() ClusterIPAMRangeInformer {
+	return &clusterIPAMRangeInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // IPAMRanges returns a IPAMRangeInformer.
 func (v *version) IPAMRanges() IPAMRangeInformer {
 	return &iPAMRangeInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
@@ -0,0 +1,65 @@
+/*
+Copyright (c) 2020 Mandelsoft. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	v1alpha1 "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ClusterIPAMRangeLister helps list ClusterIPAMRanges.
+type ClusterIPAMRangeLister interface {
+	// List lists all ClusterIPAMRanges in the indexer.
+	List(selector labels.Selector) (ret []*v1alpha1.ClusterIPAMRange, err error)
+	// Get retrieves the ClusterIPAMRange from the index for a given name.
+	Get(name string) (*v1alpha1.ClusterIPAMRange, error)
+	ClusterIPAMRangeListerExpansion
+}
+
+// clusterIPAMRangeLister implements the ClusterIPAMRangeLister interface.
+type clusterIPAMRangeLister struct {
+	indexer cache.Indexer
+}
+
+// NewClusterIPAMRangeLister returns a new ClusterIPAMRangeLister.
+func NewClusterIPAMRangeLister(indexer cache.Indexer) ClusterIPAMRangeLister {
+	return &clusterIPAMRangeLister{indexer: indexer}
+}
+
+// List lists all ClusterIPAMRanges in the indexer.
+func (s *clusterIPAMRangeLister) List(selector labels.Selector) (ret []*v1alpha1.ClusterIPAMRange, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.ClusterIPAMRange))
+	})
+	return ret, err
+}
+
+// Get retrieves the ClusterIPAMRange from the index for a given name.
+func (s *clusterIPAMRangeLister) Get(name string) (*v1alpha1.ClusterIPAMRange, error) {
+	obj, exists, err := s.indexer.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("clusteripamrange"), name)
+	}
+	return obj.(*v1alpha1.ClusterIPAMRange), nil
+}
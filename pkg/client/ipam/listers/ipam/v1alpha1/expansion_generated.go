@@ -18,6 +18,10 @@ limitations under the License.
 
 package v1alpha1
 
+// ClusterIPAMRangeListerExpansion allows custom methods to be added to
+// ClusterIPAMRangeLister.
+type ClusterIPAMRangeListerExpansion interface{}
+
 // IPAMRangeListerExpansion allows custom methods to be added to
 // IPAMRangeLister.
 type IPAMRangeListerExpansion interface{}
@@ -0,0 +1,380 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cni
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/apis/ipam/validation"
+	"github.com/mandelsoft/kubipam/pkg/client/ipam/clientset/versioned"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// annotations of the IPAMRequests created by the plugin
+const ANNOTATION_CONTAINER_ID = "ipam.mandelsoft.org/container-id"
+const ANNOTATION_NETWORK = "ipam.mandelsoft.org/network"
+const ANNOTATION_IFNAME = "ipam.mandelsoft.org/ifname"
+
+const DEFAULT_NAMESPACE = "kube-system"
+const DEFAULT_TIMEOUT = 30 * time.Second
+
+// Args are the arguments of a plugin invocation passed as
+// environment variables.
+type Args struct {
+	Command     string
+	ContainerID string
+	Netns       string
+	IfName      string
+	Path        string
+	// Args are the key value pairs of CNI_ARGS
+	Args map[string]string
+}
+
+// ArgsFromEnv reads the arguments from the environment.
+func ArgsFromEnv() *Args {
+	args := &Args{
+		Command:     os.Getenv("CNI_COMMAND"),
+		ContainerID: os.Getenv("CNI_CONTAINERID"),
+		Netns:       os.Getenv("CNI_NETNS"),
+		IfName:      os.Getenv("CNI_IFNAME"),
+		Path:        os.Getenv("CNI_PATH"),
+		Args:        map[string]string{},
+	}
+	for _, a := range strings.Split(os.Getenv("CNI_ARGS"), ";") {
+		if i := strings.Index(a, "="); i > 0 {
+			args.Args[a[:i]] = a[i+1:]
+		}
+	}
+	return args
+}
+
+// Plugin executes the operations of the CNI specification
+// for a network configuration.
+type Plugin struct {
+	conf    *NetConf
+	args    *Args
+	client  versioned.Interface
+	ref     *api.IPAMReference
+	timeout time.Duration
+}
+
+func NewPlugin(conf *NetConf, args *Args) (*Plugin, error) {
+	if args.ContainerID == "" {
+		return nil, NewError(ERR_INVALID_CONFIG, "container id not specified")
+	}
+	ref, err := api.ParseIPAMReference(conf.IPAM.Range)
+	if err != nil {
+		return nil, NewError(ERR_INVALID_CONFIG, "%s", err)
+	}
+	timeout := DEFAULT_TIMEOUT
+	if conf.IPAM.Timeout != "" {
+		timeout, err = time.ParseDuration(conf.IPAM.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, NewError(ERR_INVALID_CONFIG, "invalid timeout %q", conf.IPAM.Timeout)
+		}
+	}
+	cfg, err := clientcmd.BuildConfigFromFlags("", conf.IPAM.Kubeconfig)
+	if err != nil {
+		return nil, NewError(ERR_INVALID_CONFIG, "cannot get cluster access: %s", err)
+	}
+	client, err := versioned.NewForConfig(cfg)
+	if err != nil {
+		return nil, NewError(ERR_INVALID_CONFIG, "cannot create client: %s", err)
+	}
+	return &Plugin{
+		conf:    conf,
+		args:    args,
+		client:  client,
+		ref:     ref,
+		timeout: timeout,
+	}, nil
+}
+
+func (this *Plugin) namespace() string {
+	if this.conf.IPAM.Namespace == "" {
+		return DEFAULT_NAMESPACE
+	}
+	return this.conf.IPAM.Namespace
+}
+
+// requestName is the name of the IPAMRequest of an interface of a
+// container in a network.
+func (this *Plugin) requestName() string {
+	h := sha256.Sum256([]byte(this.conf.Name + "/" + this.args.ContainerID + "/" + this.args.IfName))
+	return "cni-" + hex.EncodeToString(h[:16])
+}
+
+// Add creates the IPAMRequest for the interface and waits
+// for the allocation.
+func (this *Plugin) Add() (*Result, error) {
+	requests := this.client.IpamV1alpha1().IPAMRequests(this.namespace())
+	r := &api.IPAMRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: this.namespace(),
+			Name:      this.requestName(),
+			Annotations: map[string]string{
+				ANNOTATION_CONTAINER_ID: this.args.ContainerID,
+				ANNOTATION_NETWORK:      this.conf.Name,
+				ANNOTATION_IFNAME:       this.args.IfName,
+			},
+		},
+		Spec: api.IPAMRequestSpec{
+			IPAM:        *this.ref,
+			Request:     this.conf.IPAM.Request,
+			IPFamilies:  this.conf.IPAM.IPFamilies,
+			Description: this.description(),
+		},
+	}
+	if r.Spec.Request == "" {
+		r.Spec.Request = "%0"
+	}
+	if err := validation.ValidateIPAMRequest(r); err != nil {
+		return nil, NewError(ERR_INVALID_CONFIG, "invalid request: %s", err)
+	}
+	_, err := requests.Create(r)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("cannot create IPAMRequest %s/%s: %s", r.Namespace, r.Name, err)
+	}
+
+	var lastErr error
+	err = wait.PollImmediate(500*time.Millisecond, this.timeout, func() (bool, error) {
+		cur, err := requests.Get(this.requestName(), metav1.GetOptions{})
+		if err != nil {
+			// access problems may be temporary, retry until timeout
+			lastErr = err
+			return false, nil
+		}
+		lastErr = nil
+		r = cur
+		return allocated(r)
+	})
+	if err != nil {
+		if err == wait.ErrWaitTimeout {
+			if lastErr != nil {
+				return nil, NewError(ERR_TRY_AGAIN_LATER, "cannot get IPAMRequest %s/%s: %s", r.Namespace, r.Name, lastErr)
+			}
+			return nil, NewError(ERR_TRY_AGAIN_LATER, "no allocation for IPAMRequest %s/%s: %s: %s", r.Namespace, r.Name, r.Status.State, r.Status.Message)
+		}
+		return nil, err
+	}
+	rng, err := this.getRange()
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(r, rng)
+}
+
+// allocated checks whether the allocation of a request is done. Requests
+// failing permanently or exceeding a quota are not waited for.
+func allocated(r *api.IPAMRequest) (bool, error) {
+	if r.Status.CIDR != "" {
+		return true, nil
+	}
+	switch r.Status.State {
+	case api.STATE_INVALID:
+		return false, fmt.Errorf("invalid IPAMRequest %s/%s: %s", r.Namespace, r.Name, r.Status.Message)
+	case api.STATE_ERROR:
+		return false, fmt.Errorf("failed IPAMRequest %s/%s: %s", r.Namespace, r.Name, r.Status.Message)
+	case api.STATE_QUOTAEXCEEDED:
+		return false, fmt.Errorf("quota exceeded for IPAMRequest %s/%s: %s", r.Namespace, r.Name, r.Status.Message)
+	}
+	return false, nil
+}
+
+// Check verifies the allocation of the interface and its
+// usage in the previous result.
+func (this *Plugin) Check() error {
+	r, err := this.client.IpamV1alpha1().IPAMRequests(this.namespace()).Get(this.requestName(), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot get IPAMRequest %s/%s: %s", this.namespace(), this.requestName(), err)
+	}
+	if r.Status.CIDR == "" {
+		return fmt.Errorf("no allocation for IPAMRequest %s/%s: %s: %s", r.Namespace, r.Name, r.Status.State, r.Status.Message)
+	}
+	if this.conf.PrevResult == nil {
+		return nil
+	}
+	for _, c := range r.GetCIDRs() {
+		ip, _, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q in IPAMRequest %s/%s", c, r.Namespace, r.Name)
+		}
+		found := false
+		for _, i := range this.conf.PrevResult.IPs {
+			a, _, err := net.ParseCIDR(i.Address)
+			if err == nil && a.Equal(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("allocated address %s not found in previous result", ip)
+		}
+	}
+	return nil
+}
+
+// Del releases the allocation of the interface by deleting
+// its IPAMRequest.
+func (this *Plugin) Del() error {
+	err := this.client.IpamV1alpha1().IPAMRequests(this.namespace()).Delete(this.requestName(), &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("cannot delete IPAMRequest %s/%s: %s", this.namespace(), this.requestName(), err)
+	}
+	return nil
+}
+
+func (this *Plugin) description() string {
+	pod := this.args.Args["K8S_POD_NAME"]
+	if pod != "" {
+		return fmt.Sprintf("interface %s of pod %s/%s in network %s", this.args.IfName, this.args.Args["K8S_POD_NAMESPACE"], pod, this.conf.Name)
+	}
+	return fmt.Sprintf("interface %s of container %s in network %s", this.args.IfName, this.args.ContainerID, this.conf.Name)
+}
+
+func (this *Plugin) getRange() (api.RangeObject, error) {
+	var rng api.RangeObject
+	var err error
+	if this.ref.IsCluster() {
+		rng, err = this.client.IpamV1alpha1().ClusterIPAMRanges().Get(this.ref.Name, metav1.GetOptions{})
+	} else {
+		rng, err = this.client.IpamV1alpha1().IPAMRanges(this.ref.Namespace).Get(this.ref.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get range %s: %s", this.conf.IPAM.Range, err)
+	}
+	return rng, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// NewResult creates the result for the allocation of a request.
+// The addresses use the netmask of the network of the range they are
+// allocated from. Gateway and routes are taken from the annotations
+// of the range.
+func NewResult(r *api.IPAMRequest, rng api.RangeObject) (*Result, error) {
+	gateways, err := parseGateways(rng.GetAnnotations()[api.ANNOTATION_GATEWAY])
+	if err != nil {
+		return nil, err
+	}
+	routes, err := parseRoutes(rng.GetAnnotations()[api.ANNOTATION_ROUTES])
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Routes: routes}
+	for _, c := range r.GetCIDRs() {
+		_, cidr, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q in IPAMRequest %s/%s", c, r.Namespace, r.Name)
+		}
+		ip := cidr.IP
+		ipc := &IPConfig{
+			Version: "6",
+			Address: (&net.IPNet{IP: ip, Mask: networkMask(rng, cidr)}).String(),
+		}
+		if ip.To4() != nil {
+			ipc.Version = "4"
+		}
+		if gw := gateways[ipam.IPFamily(ip)]; gw != nil {
+			ipc.Gateway = gw.String()
+		}
+		result.IPs = append(result.IPs, ipc)
+	}
+	return result, nil
+}
+
+// networkMask determines the netmask of the network of the range
+// containing an allocated cidr. If the range is not given by cidrs
+// the netmask of the allocated cidr is used.
+func networkMask(rng api.RangeObject, cidr *net.IPNet) net.IPMask {
+	for _, r := range rng.GetRanges() {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(r))
+		if err == nil && ipam.CIDRContains(n, cidr) {
+			return n.Mask
+		}
+	}
+	return cidr.Mask
+}
+
+// parseGateways parses a comma separated list of gateway addresses
+// with at most one address per ip family.
+func parseGateways(s string) (map[string]net.IP, error) {
+	gateways := map[string]net.IP{}
+	for _, g := range splitList(s) {
+		ip := net.ParseIP(g)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid gateway %q", g)
+		}
+		f := ipam.IPFamily(ip)
+		if gateways[f] != nil {
+			return nil, fmt.Errorf("multiple %s gateways", f)
+		}
+		gateways[f] = ip
+	}
+	return gateways, nil
+}
+
+// parseRoutes parses a comma separated list of routes of the
+// form <cidr>[ via <gateway>].
+func parseRoutes(s string) ([]*Route, error) {
+	var routes []*Route
+	for _, r := range splitList(s) {
+		fields := strings.Fields(r)
+		if len(fields) != 1 && (len(fields) != 3 || fields[1] != "via") {
+			return nil, fmt.Errorf("invalid route %q: use <cidr>[ via <gateway>]", r)
+		}
+		_, dst, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q: %s", r, err)
+		}
+		route := &Route{Dst: dst.String()}
+		if len(fields) == 3 {
+			gw := net.ParseIP(fields[2])
+			if gw == nil {
+				return nil, fmt.Errorf("invalid route %q: invalid gateway %q", r, fields[2])
+			}
+			route.GW = gw.String()
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cni
+
+import (
+	"bytes"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+)
+
+var _ = Describe("CNI", func() {
+
+	Context("config", func() {
+		It("parses config", func() {
+			conf, err := ParseNetConf([]byte(`{"cniVersion":"0.4.0","name":"net","type":"macvlan","ipam":{"type":"kubipam","range":"pool","kubeconfig":"/etc/cni/net.d/kubipam.kubeconfig"}}`))
+			Expect(err).To(BeNil())
+			Expect(conf.Name).To(Equal("net"))
+			Expect(conf.IPAM.Range).To(Equal("pool"))
+		})
+		It("rejects unsupported version", func() {
+			_, err := ParseNetConf([]byte(`{"cniVersion":"0.2.0","name":"net","ipam":{"range":"pool"}}`))
+			Expect(err.(*Error).Code).To(Equal(uint(ERR_INCOMPATIBLE_VERSION)))
+		})
+		It("rejects missing range", func() {
+			_, err := ParseNetConf([]byte(`{"cniVersion":"0.4.0","name":"net","ipam":{}}`))
+			Expect(err.(*Error).Code).To(Equal(uint(ERR_INVALID_CONFIG)))
+		})
+		It("rejects missing kubeconfig", func() {
+			_, err := ParseNetConf([]byte(`{"cniVersion":"0.4.0","name":"net","ipam":{"range":"pool"}}`))
+			Expect(err.(*Error).Code).To(Equal(uint(ERR_INVALID_CONFIG)))
+			Expect(err.(*Error).Msg).To(Equal("kubeconfig not specified"))
+		})
+	})
+
+	Context("allocation", func() {
+		var r *api.IPAMRequest
+
+		BeforeEach(func() {
+			r = &api.IPAMRequest{}
+			r.Namespace = "kube-system"
+			r.Name = "cni-test"
+		})
+
+		It("waits for pending requests", func() {
+			r.Status.State = api.STATE_BUSY
+			Expect(allocated(r)).To(BeFalse())
+		})
+		It("is done with an allocated cidr", func() {
+			r.Status.State = api.STATE_READY
+			r.Status.CIDR = "10.0.0.1/32"
+			Expect(allocated(r)).To(BeTrue())
+		})
+		It("fails for permanent errors", func() {
+			for _, state := range []string{api.STATE_INVALID, api.STATE_ERROR, api.STATE_QUOTAEXCEEDED} {
+				r.Status.State = state
+				_, err := allocated(r)
+				Expect(err).NotTo(BeNil())
+			}
+		})
+	})
+
+	Context("result", func() {
+		var rng *api.ClusterIPAMRange
+		var req *api.IPAMRequest
+
+		BeforeEach(func() {
+			rng = &api.ClusterIPAMRange{}
+			rng.Spec.Ranges = []string{"10.0.0.0/24", "fd00::/64"}
+			rng.Annotations = map[string]string{
+				api.ANNOTATION_GATEWAY: "10.0.0.1, fd00::1",
+				api.ANNOTATION_ROUTES:  "0.0.0.0/0, 192.168.0.0/16 via 10.0.0.254",
+			}
+			req = &api.IPAMRequest{}
+			req.Status.CIDR = "10.0.0.5/32"
+			req.Status.CIDRs = []string{"10.0.0.5/32", "fd00::5/128"}
+		})
+
+		It("uses range netmask, gateway and routes", func() {
+			result, err := NewResult(req, rng)
+			Expect(err).To(BeNil())
+			Expect(result.IPs).To(Equal([]*IPConfig{
+				{Version: "4", Address: "10.0.0.5/24", Gateway: "10.0.0.1"},
+				{Version: "6", Address: "fd00::5/64", Gateway: "fd00::1"},
+			}))
+			Expect(result.Routes).To(Equal([]*Route{
+				{Dst: "0.0.0.0/0"},
+				{Dst: "192.168.0.0/16", GW: "10.0.0.254"},
+			}))
+		})
+
+		It("uses allocated cidr for ip ranges", func() {
+			rng.Spec.Ranges = []string{"10.0.0.10-10.0.0.20"}
+			rng.Annotations = nil
+			req.Status.CIDRs = nil
+			result, err := NewResult(req, rng)
+			Expect(err).To(BeNil())
+			Expect(result.IPs).To(Equal([]*IPConfig{{Version: "4", Address: "10.0.0.5/32"}}))
+			Expect(result.Routes).To(BeNil())
+		})
+
+		It("rejects invalid routes", func() {
+			rng.Annotations[api.ANNOTATION_ROUTES] = "10.0.0.0/8 to 10.0.0.1"
+			_, err := NewResult(req, rng)
+			Expect(err).To(Equal(fmt.Errorf("invalid route %q: use <cidr>[ via <gateway>]", "10.0.0.0/8 to 10.0.0.1")))
+		})
+
+		It("prints version dependent result", func() {
+			result, err := NewResult(req, rng)
+			Expect(err).To(BeNil())
+			buf := &bytes.Buffer{}
+			Expect(result.Print(buf, "1.0.0")).To(Succeed())
+			Expect(buf.String()).NotTo(ContainSubstring(`"version"`))
+			Expect(buf.String()).To(ContainSubstring(`"cniVersion":"1.0.0"`))
+		})
+	})
+})
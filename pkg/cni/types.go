@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SupportedVersions are the versions of the CNI specification
+// supported by the plugin.
+var SupportedVersions = []string{"0.3.0", "0.3.1", "0.4.0", "1.0.0"}
+
+// error codes of the CNI specification
+const (
+	ERR_INCOMPATIBLE_VERSION = 1
+	ERR_DECODE               = 6
+	ERR_INVALID_CONFIG       = 7
+	ERR_TRY_AGAIN_LATER      = 11
+	ERR_INTERNAL             = 999
+)
+
+// NetConf is the network configuration passed to the plugin.
+type NetConf struct {
+	CNIVersion string     `json:"cniVersion"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	IPAM       IPAMConfig `json:"ipam"`
+	PrevResult *Result    `json:"prevResult,omitempty"`
+}
+
+// IPAMConfig is the ipam section of the network configuration.
+type IPAMConfig struct {
+	Type string `json:"type"`
+	// Kubeconfig is the kubeconfig used to access the cluster. It is
+	// required, because the plugin is executed on the host.
+	Kubeconfig string `json:"kubeconfig"`
+	// Namespace is the namespace of the IPAMRequests (default kube-system)
+	Namespace string `json:"namespace,omitempty"`
+	// Range is the range to allocate from, <namespace>/<name> for an
+	// IPAMRange, <name> for a ClusterIPAMRange
+	Range string `json:"range"`
+	// Request is the request spec (default: a single address)
+	Request string `json:"request,omitempty"`
+	// IPFamilies are the ip families to allocate addresses for
+	IPFamilies []string `json:"ipFamilies,omitempty"`
+	// Timeout is the maximum time to wait for an allocation (default 30s)
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Result is the result of an ADD operation.
+type Result struct {
+	CNIVersion string      `json:"cniVersion,omitempty"`
+	IPs        []*IPConfig `json:"ips,omitempty"`
+	Routes     []*Route    `json:"routes,omitempty"`
+	DNS        DNS         `json:"dns,omitempty"`
+}
+
+// IPConfig describes an address assigned to an interface.
+type IPConfig struct {
+	// Version is only used up to version 0.4.0 of the specification
+	Version string `json:"version,omitempty"`
+	Address string `json:"address"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+type Route struct {
+	Dst string `json:"dst"`
+	GW  string `json:"gw,omitempty"`
+}
+
+type DNS struct {
+	Nameservers []string `json:"nameservers,omitempty"`
+	Domain      string   `json:"domain,omitempty"`
+	Search      []string `json:"search,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// Error is the error result of an operation.
+type Error struct {
+	CNIVersion string `json:"cniVersion,omitempty"`
+	Code       uint   `json:"code"`
+	Msg        string `json:"msg"`
+	Details    string `json:"details,omitempty"`
+}
+
+func (this *Error) Error() string {
+	if this.Details == "" {
+		return this.Msg
+	}
+	return fmt.Sprintf("%s; %s", this.Msg, this.Details)
+}
+
+func NewError(code uint, msg string, args ...interface{}) *Error {
+	return &Error{Code: code, Msg: fmt.Sprintf(msg, args...)}
+}
+
+// VersionInfo is the result of a VERSION operation.
+type VersionInfo struct {
+	CNIVersion        string   `json:"cniVersion"`
+	SupportedVersions []string `json:"supportedVersions"`
+}
+
+// ParseNetConf parses the network configuration and checks the
+// requested version of the specification.
+func ParseNetConf(data []byte) (*NetConf, error) {
+	conf := &NetConf{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, NewError(ERR_DECODE, "cannot decode network configuration: %s", err)
+	}
+	if conf.CNIVersion == "" {
+		conf.CNIVersion = "0.3.0"
+	}
+	if !IsSupportedVersion(conf.CNIVersion) {
+		return nil, NewError(ERR_INCOMPATIBLE_VERSION, "unsupported CNI version %q: use one of %s", conf.CNIVersion, strings.Join(SupportedVersions, ", "))
+	}
+	if conf.IPAM.Range == "" {
+		return nil, NewError(ERR_INVALID_CONFIG, "range not specified")
+	}
+	if conf.IPAM.Kubeconfig == "" {
+		return nil, NewError(ERR_INVALID_CONFIG, "kubeconfig not specified")
+	}
+	return conf, nil
+}
+
+func IsSupportedVersion(version string) bool {
+	for _, v := range SupportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes a result in the format of the requested version
+// of the specification.
+func (this *Result) Print(w io.Writer, version string) error {
+	this.CNIVersion = version
+	for _, ip := range this.IPs {
+		if !strings.HasPrefix(version, "0.") {
+			ip.Version = ""
+		}
+	}
+	return json.NewEncoder(w).Encode(this)
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// CMD_CHECK triggers the consistency check of all allocations.
+const CMD_CHECK = "check"
+
+// claim is a cidr allocated for an object.
+type claim struct {
+	key  resources.ClusterObjectKey
+	cidr *net.IPNet
+}
+
+func (this claim) String() string {
+	return fmt.Sprintf("%s (%s %s)", this.cidr, this.key.GroupKind().Kind, this.key.ObjectName())
+}
+
+// conflict is a cidr of an object overlapping with a claim of another object.
+type conflict struct {
+	cidr  *net.IPNet
+	other claim
+}
+
+func (this conflict) String() string {
+	return fmt.Sprintf("cidr %s overlaps with cidr %s", this.cidr, this.other)
+}
+
+func (this *Reconciler) Start() {
+	this.Controller().EnqueueCommand(CMD_CHECK)
+}
+
+func (this *Reconciler) Command(logger logger.LogContext, cmd string) reconcile.Status {
+	if cmd == CMD_CHECK {
+		this.check(logger)
+		if this.config.CheckPeriod > 0 {
+			return reconcile.Succeeded(logger).RescheduleAfter(this.config.CheckPeriod)
+		}
+	}
+	return reconcile.Succeeded(logger)
+}
+
+// check verifies the allocations of all ranges against the cidrs
+// claimed by the requests and sub ranges using them.
+func (this *Reconciler) check(logger logger.LogContext) {
+	logger.Infof("checking consistency of allocations")
+	this.lock.RLock()
+	ranges := make([]*IPAM, 0, len(this.ipams))
+	for _, o := range this.ipams {
+		ranges = append(ranges, o)
+	}
+	this.lock.RUnlock()
+
+	conflicts := map[resources.ClusterObjectKey][]conflict{}
+	for _, o := range ranges {
+		this.checkRange(logger, o, conflicts)
+	}
+	this.setConflicts(conflicts)
+}
+
+// claims returns the cidrs claimed by the users of a range.
+func (this *Reconciler) claims(key resources.ClusterObjectKey) []claim {
+	var claims []claim
+	for user := range this.GetUsersFor(key) {
+		obj, err := this.Controller().GetCachedObject(user)
+		if err != nil {
+			continue
+		}
+		var cidrs []string
+		switch o := obj.Data().(type) {
+		case *api.IPAMRequest:
+			cidrs = o.GetCIDRs()
+		case api.RangeObject:
+			cidrs = o.GetStatus().CIDRs
+		}
+		for _, c := range cidrs {
+			_, cidr, err := net.ParseCIDR(c)
+			if err == nil {
+				claims = append(claims, claim{user, cidr})
+			}
+		}
+	}
+	return claims
+}
+
+// overlaps returns all pairs of overlapping claims.
+func overlaps(claims []claim) [][2]claim {
+	var result [][2]claim
+	sort.Slice(claims, func(i, j int) bool {
+		if d := ipam.IPCmp(claims[i].cidr.IP, claims[j].cidr.IP); d != 0 {
+			return d < 0
+		}
+		return ipam.CIDRNetMaskSize(claims[i].cidr) < ipam.CIDRNetMaskSize(claims[j].cidr)
+	})
+	// cidrs either contain each other or are disjoint. Therefore all
+	// claims on the stack of enclosing claims overlap with the next one.
+	var stack []claim
+	for _, c := range claims {
+		for len(stack) > 0 && !ipam.CIDRContains(stack[len(stack)-1].cidr, c.cidr) {
+			stack = stack[:len(stack)-1]
+		}
+		for _, o := range stack {
+			result = append(result, [2]claim{o, c})
+		}
+		stack = append(stack, c)
+	}
+	return result
+}
+
+// checkRange verifies the allocations of a single range. Differences
+// between the allocations and the claims are only considered if they
+// are found by two consecutive checks, because the claims are taken
+// from the cache, which might not yet reflect the latest changes.
+func (this *Reconciler) checkRange(logger logger.LogContext, o *IPAM, conflicts map[resources.ClusterObjectKey][]conflict) {
+	o.lock.RLock()
+	key := o.object.ClusterKey()
+	o.lock.RUnlock()
+
+	claims := this.claims(key)
+	var found []string
+	for _, pair := range overlaps(claims) {
+		a, b := pair[0], pair[1]
+		conflicts[a.key] = append(conflicts[a.key], conflict{a.cidr, b})
+		conflicts[b.key] = append(conflicts[b.key], conflict{b.cidr, a})
+		found = append(found, fmt.Sprintf("%s overlaps with %s", a, b))
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	suspects := map[string]bool{}
+	var orphans []string
+	for _, pool := range o.ipams {
+		expected, err := expectedState(pool, claims)
+		if err != nil {
+			logger.Errorf("cannot check %s: %s", key.ObjectName(), err)
+			return
+		}
+		unclaimed, missing := pool.Diff(expected)
+		for _, c := range missing {
+			id := "missing:" + c.String()
+			suspects[id] = true
+			if o.suspects[id] {
+				logger.Warnf("%s: cidr %s claimed but not allocated: marking as busy", key.ObjectName(), c)
+				o.object.Eventf(corev1.EventTypeWarning, "consistency", "cidr %s claimed but not allocated: marking as busy", c)
+				pool.Busy(c)
+			}
+		}
+		for _, c := range unclaimed {
+			id := "orphan:" + c.String()
+			suspects[id] = true
+			if o.suspects[id] {
+				orphans = append(orphans, c.String())
+			}
+		}
+	}
+	o.suspects = suspects
+
+	for _, c := range orphans {
+		if !contains(o.orphans, c) {
+			logger.Warnf("%s: orphaned cidr %s", key.ObjectName(), c)
+			o.object.Eventf(corev1.EventTypeWarning, "consistency", "cidr %s allocated but not used by any object", c)
+		}
+	}
+	if !reflect.DeepEqual(orphans, o.orphans) || !reflect.DeepEqual(found, o.conflicts) {
+		o.orphans = orphans
+		o.conflicts = found
+		this.Controller().Enqueue(o.object)
+	}
+}
+
+// expectedState creates an ipam for the ranges of a pool with all
+// reserved, cooling and claimed cidrs allocated.
+func expectedState(pool *ipam.IPAM, claims []claim) (*ipam.IPAM, error) {
+	var ranges ipam.IPRanges
+	for _, c := range append(pool.Ranges(), pool.PendingDeleted()...) {
+		ranges = append(ranges, ipam.CIDRRange(c))
+	}
+	expected, err := ipam.NewIPAMForRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range pool.Reserved() {
+		expected.Busy(c)
+	}
+	for _, c := range pool.Cooling() {
+		expected.Busy(c.CIDR)
+	}
+	for _, c := range claims {
+		if ipam.CIDRFamily(c.cidr) == pool.Family() {
+			expected.Busy(c.cidr)
+		}
+	}
+	return expected, nil
+}
+
+// setConflicts stores the conflicts found by a check. Objects with
+// changed conflicts are reported and enqueued to update their state.
+func (this *Reconciler) setConflicts(conflicts map[resources.ClusterObjectKey][]conflict) {
+	this.conflictLock.Lock()
+	old := this.conflicts
+	this.conflicts = conflicts
+	this.conflictLock.Unlock()
+
+	for key, list := range conflicts {
+		if reflect.DeepEqual(conflictStrings(list), conflictStrings(old[key])) {
+			continue
+		}
+		if obj, err := this.Controller().GetCachedObject(key); err == nil {
+			for _, c := range list {
+				obj.Eventf(corev1.EventTypeWarning, "conflict", "%s", c)
+			}
+		}
+		this.Controller().EnqueueKey(key)
+	}
+	for key := range old {
+		if _, ok := conflicts[key]; !ok {
+			this.Controller().EnqueueKey(key)
+		}
+	}
+}
+
+// conflictMessage returns a description of the conflicts of an object.
+func (this *Reconciler) conflictMessage(key resources.ClusterObjectKey) string {
+	this.conflictLock.Lock()
+	defer this.conflictLock.Unlock()
+	list := this.conflicts[key]
+	if len(list) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("conflicting allocation: %s", strings.Join(conflictStrings(list), ", "))
+}
+
+// restoreConflicts marks the cidrs of objects conflicting with a released
+// object as busy again, because they are still used by those objects.
+// It returns the cidrs marked busy.
+func (this *Reconciler) restoreConflicts(ipr *IPAM, key resources.ClusterObjectKey) []*net.IPNet {
+	this.conflictLock.Lock()
+	defer this.conflictLock.Unlock()
+	var restored []*net.IPNet
+	for _, c := range this.conflicts[key] {
+		if pool := ipr.forCIDR(c.other.cidr); pool != nil {
+			if pool.Busy(c.other.cidr) {
+				restored = append(restored, c.other.cidr)
+			}
+		}
+	}
+	return restored
+}
+
+// undoRestoreConflicts frees the cidrs marked busy by restoreConflicts
+// again, if the release of the object is undone.
+func undoRestoreConflicts(ipr *IPAM, restored []*net.IPNet) {
+	for _, c := range restored {
+		if pool := ipr.forCIDR(c); pool != nil {
+			pool.Revert(c)
+		}
+	}
+}
+
+// dropConflicts removes the conflicts of a deleted object. Objects
+// conflicting only with this object are enqueued to update their state.
+func (this *Reconciler) dropConflicts(key resources.ClusterObjectKey) {
+	this.conflictLock.Lock()
+	defer this.conflictLock.Unlock()
+	for _, c := range this.conflicts[key] {
+		other := c.other.key
+		var list []conflict
+		for _, o := range this.conflicts[other] {
+			if !resources.EqualsClusterObjectKey(o.other.key, key) {
+				list = append(list, o)
+			}
+		}
+		if len(list) == 0 {
+			delete(this.conflicts, other)
+		} else {
+			this.conflicts[other] = list
+		}
+		this.Controller().EnqueueKey(other)
+	}
+	delete(this.conflicts, key)
+}
+
+func conflictStrings(list []conflict) []string {
+	var result []string
+	for _, c := range list {
+		result = append(result, c.String())
+	}
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// checkpointName is the name of the config map used to
+// checkpoint the allocation state of a range.
+func checkpointName(obj resources.Object) resources.ObjectName {
+	return resources.NewObjectName(obj.GetNamespace(), obj.GetName()+"-ipam-checkpoint")
+}
+
+// readCheckpoint reads the checkpointed allocation state of a range.
+// It returns nil if there is no checkpoint.
+func (this *Reconciler) readCheckpoint(obj resources.Object) ([]string, error) {
+	r := obj.Data().(api.RangeObject)
+	switch r.GetSpec().Checkpoint {
+	case api.CHECKPOINT_STATUS:
+		return r.GetStatus().Checkpoint, nil
+	case api.CHECKPOINT_CONFIGMAP:
+		cm := &corev1.ConfigMap{}
+		_, err := obj.Resources().GetObjectInto(checkpointName(obj), cm)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		data, ok := cm.Data[api.CHECKPOINT_KEY]
+		if !ok {
+			return nil, nil
+		}
+		var blocks []string
+		for _, b := range strings.Split(data, "\n") {
+			if b != "" {
+				blocks = append(blocks, b)
+			}
+		}
+		return blocks, nil
+	}
+	return nil, nil
+}
+
+// replay marks the cidr of an allocation found during the setup as busy.
+// Cidrs already allocated for another object are recorded as duplicates.
+// It returns false if the range does not provide a pool for the cidr.
+func (this *IPAM) replay(user resources.Object, cidr *net.IPNet) bool {
+	pool := this.forCIDR(cidr)
+	if pool == nil {
+		return false
+	}
+	if !pool.Busy(cidr) {
+		msg := fmt.Sprintf("cidr %s of %s %s already allocated", cidr, user.GroupKind().Kind, user.ObjectName())
+		this.duplicates = append(this.duplicates, msg)
+		user.Eventf(corev1.EventTypeWarning, "allocation", "duplicate allocation in IPAMRange %s: %s", this.object.ObjectName(), msg)
+	}
+	this.setOwner(user.ObjectName(), cidr)
+	return true
+}
+
+// verifyCheckpoints cross-checks the checkpoints of all ranges with the
+// allocations replayed from the requests and ranges after the setup.
+func (this *Reconciler) verifyCheckpoints() {
+	for n, o := range this.ipams {
+		if o.restored == nil {
+			continue
+		}
+		lost, untracked, err := o.verifyCheckpoint()
+		if err != nil {
+			this.Controller().Errorf("invalid checkpoint for %s: %s", n, err)
+			o.object.Eventf(corev1.EventTypeWarning, "checkpoint", "invalid checkpoint: %s", err)
+			o.condition = newCondition(api.CONDITION_CHECKPOINT_CONSISTENT, false, "InvalidCheckpoint", err.Error())
+			continue
+		}
+		var msgs []string
+		if len(lost) > 0 {
+			msgs = append(msgs, fmt.Sprintf("checkpointed allocations not found: %s", strings.Join(lost, ", ")))
+		}
+		if len(untracked) > 0 {
+			msgs = append(msgs, fmt.Sprintf("allocations missing in checkpoint: %s", strings.Join(untracked, ", ")))
+		}
+		if len(o.duplicates) > 0 {
+			msgs = append(msgs, fmt.Sprintf("duplicate allocations: %s", strings.Join(o.duplicates, ", ")))
+		}
+		if len(msgs) > 0 {
+			for _, msg := range msgs {
+				this.Controller().Errorf("inconsistent checkpoint for %s: %s", n, msg)
+				o.object.Event(corev1.EventTypeWarning, "checkpoint", msg)
+			}
+			o.condition = newCondition(api.CONDITION_CHECKPOINT_CONSISTENT, false, "Inconsistent", strings.Join(msgs, "; "))
+		} else {
+			this.Controller().Infof("checkpoint for %s verified", n)
+			o.condition = newCondition(api.CONDITION_CHECKPOINT_CONSISTENT, true, "Consistent", "checkpoint matches allocations")
+		}
+	}
+}
+
+// verifyCheckpoint compares the checkpointed allocation state with
+// the actual state. It returns the checkpointed allocations not found
+// anymore and the allocations not found in the checkpoint.
+func (this *IPAM) verifyCheckpoint() ([]string, []string, error) {
+	var lost, untracked []string
+	for _, ipr := range this.ipams {
+		var blocks []string
+		for _, b := range this.restored {
+			i := strings.Index(b, "[")
+			if i < 0 {
+				return nil, nil, fmt.Errorf("invalid block state %q", b)
+			}
+			cidr, err := ipam.ParseCIDR(b[:i])
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid block state %q: %s", b, err)
+			}
+			if ipam.CIDRFamily(cidr) == ipr.Family() {
+				blocks = append(blocks, b)
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		var ranges ipam.IPRanges
+		for _, c := range ipr.Ranges() {
+			ranges = append(ranges, ipam.CIDRRange(c))
+		}
+		state, err := ipam.NewIPAMForRanges(ranges)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := state.SetState(blocks, nil); err != nil {
+			return nil, nil, err
+		}
+		l, u := state.Diff(ipr)
+		lost = append(lost, assignedCIDRs(l)...)
+		untracked = append(untracked, assignedCIDRs(u)...)
+	}
+	return lost, untracked, nil
+}
+
+// checkpointState returns the allocation state of all ip families
+// as used for a checkpoint.
+func (this *IPAM) checkpointState() []string {
+	state := []string{}
+	for _, ipr := range this.ipams {
+		blocks, _ := ipr.State()
+		state = append(state, blocks...)
+	}
+	return state
+}
+
+// updateCheckpoint updates the checkpoint and the conditions in the
+// status of the range object.
+func (this *IPAM) updateCheckpoint(mod *resources.ModificationState) {
+	r := mod.Data().(api.RangeObject)
+	var state []string
+	if r.GetSpec().Checkpoint == api.CHECKPOINT_STATUS {
+		state = this.checkpointState()
+	}
+	if !reflect.DeepEqual(state, r.GetStatus().Checkpoint) {
+		r.GetStatus().Checkpoint = state
+		mod.Modify(true)
+	}
+
+	var conditions []api.IPAMRangeCondition
+	if r.GetSpec().Checkpoint != "" && this.condition != nil {
+		c := *this.condition
+		if old := r.GetCondition(c.Type); old != nil && old.Status == c.Status {
+			c.LastTransitionTime = old.LastTransitionTime
+		}
+		conditions = append(conditions, c)
+	}
+	if !reflect.DeepEqual(conditions, r.GetStatus().Conditions) {
+		r.GetStatus().Conditions = conditions
+		mod.Modify(true)
+	}
+}
+
+// writeCheckpoint writes the allocation state into the checkpoint
+// config map, if enabled for the range.
+func (this *IPAM) writeCheckpoint(logger logger.LogContext) {
+	r := this.object.Data().(api.RangeObject)
+	if r.GetSpec().Checkpoint != api.CHECKPOINT_CONFIGMAP {
+		return
+	}
+	name := checkpointName(this.object)
+	cm := &corev1.ConfigMap{}
+	cm.SetNamespace(name.Namespace())
+	cm.SetName(name.Name())
+	obj, err := this.object.Resources().Wrap(cm)
+	if err == nil {
+		data := strings.Join(this.checkpointState(), "\n")
+		_, err = resources.CreateOrModify(obj, func(mod *resources.ModificationState) error {
+			cm := mod.Data().(*corev1.ConfigMap)
+			mod.AddOwners(this.object)
+			if cm.Data[api.CHECKPOINT_KEY] != data {
+				if cm.Data == nil {
+					cm.Data = map[string]string{}
+				}
+				cm.Data[api.CHECKPOINT_KEY] = data
+				mod.Modify(true)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		this.object.Eventf(corev1.EventTypeWarning, "checkpoint", "checkpoint update failed: %s", err)
+		logger.Errorf("checkpoint update failed: %s", err)
+	}
+}
+
+func newCondition(t string, status bool, reason, msg string) *api.IPAMRangeCondition {
+	s := "False"
+	if status {
+		s = "True"
+	}
+	return &api.IPAMRangeCondition{
+		Type:               t,
+		Status:             s,
+		Reason:             reason,
+		Message:            msg,
+		LastTransitionTime: metav1.Now(),
+	}
+}
@@ -19,15 +19,19 @@
 package controllers
 
 import (
+	"time"
+
 	"github.com/gardener/controller-manager-library/pkg/config"
 )
 
 type Config struct {
+	CheckPeriod time.Duration
 }
 
 var _ config.OptionSource = &Config{}
 
 func (this *Config) AddOptionsToSet(set config.OptionSet) {
+	set.AddDurationOption(&this.CheckPeriod, "consistency-check-period", "", 5*time.Minute, "period of the consistency check of all allocations (0 checks only on startup)")
 }
 
 func (this *Config) Prepare() error {
@@ -28,6 +28,7 @@ import (
 
 	"github.com/mandelsoft/kubipam/pkg/apis/ipam/crds"
 	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/metrics"
 )
 
 const NAME = "ipam"
@@ -43,8 +44,9 @@ func init() {
 		OptionsByExample("options", &Config{}).
 		Reconciler(Create).
 		MainResourceByGK(api.IPAMRANGE).
-		WatchesByGK(api.IPAMREQUEST).
-		With(reconcilers.UsageReconcilerForGKs("ipam", controller.CLUSTER_MAIN, api.IPAMRANGE)).
+		WatchesByGK(api.IPAMREQUEST, api.CLUSTERIPAMRANGE, NAMESPACE).
+		Commands(CMD_CHECK).
+		With(reconcilers.UsageReconcilerForGKs("ipam", controller.CLUSTER_MAIN, api.IPAMRANGE, api.CLUSTERIPAMRANGE)).
 		MustRegister()
 }
 
@@ -57,10 +59,12 @@ func Create(controller controller.Interface) (reconcile.Interface, error) {
 	}
 	config := cfg.(*Config)
 
-	return &Reconciler{
+	reconciler := &Reconciler{
 		ReconcilerSupport: reconcilers.NewReconcilerSupport(controller),
 		config:            config,
 		SimpleUsageCache:  reconcilers.GetSharedSimpleUsageCache(controller),
 		ipams:             map[resources.ObjectName]*IPAM{},
-	}, nil
+	}
+	metrics.RegisterRangeSource(reconciler)
+	return reconciler, nil
 }
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// restoreCooling restores the cooling cidrs found in the status
+// of the range object during the setup.
+func (this *IPAM) restoreCooling(logger logger.LogContext) {
+	for _, c := range this.cooling {
+		cidr, err := ipam.ParseCIDR(c.CIDR)
+		if err != nil {
+			logger.Errorf("invalid cooling cidr %q for %s: %s", c.CIDR, this.object.ObjectName(), err)
+			continue
+		}
+		pool := this.forCIDR(cidr)
+		if pool == nil || !pool.Cool(cidr, c.Until.Time) {
+			logger.Warnf("cannot restore cooling cidr %s for %s", cidr, this.object.ObjectName())
+		}
+	}
+	this.cooling = nil
+}
+
+// expireCooling releases the cidrs of all ip families with an
+// expired release cooldown. It reports whether cidrs have been released.
+func (this *IPAM) expireCooling(logger logger.LogContext) bool {
+	expired := false
+	for _, ipr := range this.ipams {
+		if freed := ipr.ExpireCooling(); len(freed) > 0 {
+			logger.Infof("cooldown of %s expired", freed)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// nextCoolingExpiry returns the time until the next cooldown
+// of all ip families expires or 0.
+func (this *IPAM) nextCoolingExpiry() time.Duration {
+	var next time.Time
+	for _, ipr := range this.ipams {
+		if t, ok := ipr.NextCoolingExpiry(); ok && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	if next.IsZero() {
+		return 0
+	}
+	if d := time.Until(next); d > time.Second {
+		return d
+	}
+	return time.Second
+}
+
+func (this *IPAM) isCooling() bool {
+	for _, ipr := range this.ipams {
+		if len(ipr.Cooling()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// coolingState returns the cooling cidrs of all ip families
+// as used by the status of an IPAMRange.
+func (this *IPAM) coolingState() []api.IPAMRangeCooling {
+	var state []api.IPAMRangeCooling
+	for _, ipr := range this.ipams {
+		for _, c := range ipr.Cooling() {
+			state = append(state, api.IPAMRangeCooling{
+				CIDR:  c.CIDR.String(),
+				Until: metav1.NewTime(c.Until.Truncate(time.Second).Local()),
+			})
+		}
+	}
+	return state
+}
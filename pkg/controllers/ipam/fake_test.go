@@ -0,0 +1,182 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/cluster"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile/reconcilers"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The fakes keep all objects in memory. Only the methods used by the
+// reconciler are implemented, all others panic.
+
+const TEST_CLUSTER = "test"
+
+// testObject is an object updated in memory.
+type testObject struct {
+	resources.Object
+	gk     schema.GroupKind
+	data   resources.ObjectData
+	events []string
+}
+
+func newTestObject(gk schema.GroupKind, data resources.ObjectData) *testObject {
+	return &testObject{gk: gk, data: data}
+}
+
+func (this *testObject) GroupKind() schema.GroupKind               { return this.gk }
+func (this *testObject) Data() resources.ObjectData                { return this.data }
+func (this *testObject) GetNamespace() string                      { return this.data.GetNamespace() }
+func (this *testObject) GetName() string                           { return this.data.GetName() }
+func (this *testObject) GetUID() types.UID                         { return this.data.GetUID() }
+func (this *testObject) GetLabels() map[string]string              { return this.data.GetLabels() }
+func (this *testObject) GetAnnotations() map[string]string         { return this.data.GetAnnotations() }
+func (this *testObject) Resources() resources.Resources            { return &testResources{} }
+func (this *testObject) Modify(m resources.Modifier) (bool, error) { return m(this.data) }
+
+func (this *testObject) ModifyStatus(m resources.Modifier) (bool, error) {
+	return m(this.data)
+}
+
+func (this *testObject) ObjectName() resources.ObjectName {
+	return resources.NewObjectName(this.GetNamespace(), this.GetName())
+}
+
+func (this *testObject) ClusterKey() resources.ClusterObjectKey {
+	return resources.NewClusterKey(TEST_CLUSTER, this.gk, this.GetNamespace(), this.GetName())
+}
+
+func (this *testObject) Event(eventtype, reason, message string) {
+	this.events = append(this.events, fmt.Sprintf("%s %s: %s", eventtype, reason, message))
+}
+
+func (this *testObject) Eventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	this.Event(eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// resourcesInterface is embedded by an alias, because the interface
+// declares a method with the name of the type.
+type resourcesInterface = resources.Resources
+
+// testResources provides the objects of a kind.
+type testResources struct {
+	resourcesInterface
+	objects map[schema.GroupKind]*testResource
+}
+
+func (this *testResources) Get(spec interface{}) (resources.Interface, error) {
+	gk := spec.(schema.GroupKind)
+	if r := this.objects[gk]; r != nil {
+		return r, nil
+	}
+	return nil, fmt.Errorf("resource %s not found", gk)
+}
+
+func (this *testResources) Wrap(data resources.ObjectData) (resources.Object, error) {
+	return newTestObject(schema.GroupKind{}, data), nil
+}
+
+// testResource is a resource caching objects by name.
+type testResource struct {
+	resources.Interface
+	gk      schema.GroupKind
+	objects map[string]resources.Object
+}
+
+func (this *testResource) GetCached(spec interface{}) (resources.Object, error) {
+	if o := this.objects[spec.(string)]; o != nil {
+		return o, nil
+	}
+	return nil, errors.NewNotFound(schema.GroupResource{Group: this.gk.Group, Resource: this.gk.Kind}, spec.(string))
+}
+
+// testCluster is a cluster with in memory resources.
+type testCluster struct {
+	cluster.Interface
+	resources *testResources
+}
+
+func (this *testCluster) GetId() string                  { return TEST_CLUSTER }
+func (this *testCluster) Resources() resources.Resources { return this.resources }
+
+// testController records the enqueued keys.
+type testController struct {
+	controller.Interface
+	cluster  *testCluster
+	enqueued resources.ClusterObjectKeySet
+}
+
+func (this *testController) GetMainCluster() cluster.Interface       { return this.cluster }
+func (this *testController) HasFinalizer(obj resources.Object) bool  { return true }
+func (this *testController) SetFinalizer(obj resources.Object) error { return nil }
+func (this *testController) Enqueue(obj resources.Object) error {
+	return this.EnqueueKey(obj.ClusterKey())
+}
+
+func (this *testController) GetCachedObject(key resources.ClusterObjectKey) (resources.Object, error) {
+	r, err := this.cluster.resources.Get(key.GroupKind())
+	if err != nil {
+		return nil, err
+	}
+	o, err := r.GetCached(key.Name())
+	if err != nil || o.GetNamespace() != key.Namespace() {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: key.Group(), Resource: key.Kind()}, key.Name())
+	}
+	return o, nil
+}
+
+func (this *testController) EnqueueKey(key resources.ClusterObjectKey) error {
+	this.enqueued.Add(key)
+	return nil
+}
+
+// newTestReconciler creates a reconciler for in memory objects.
+func newTestReconciler() (*Reconciler, *testController) {
+	c := &testController{
+		cluster: &testCluster{
+			resources: &testResources{objects: map[schema.GroupKind]*testResource{}},
+		},
+		enqueued: resources.NewClusterObjectKeySet(),
+	}
+	return &Reconciler{
+		ReconcilerSupport: reconcilers.NewReconcilerSupport(c),
+		config:            &Config{},
+		SimpleUsageCache:  reconcilers.NewSimpleUsageCache(),
+		ipams:             map[resources.ObjectName]*IPAM{},
+	}, c
+}
+
+// addObject adds an object to the cache of the test cluster.
+func (this *testController) addObject(gk schema.GroupKind, data resources.ObjectData) *testObject {
+	r := this.cluster.resources.objects[gk]
+	if r == nil {
+		r = &testResource{gk: gk, objects: map[string]resources.Object{}}
+		this.cluster.resources.objects[gk] = r
+	}
+	o := newTestObject(gk, data)
+	r.objects[data.GetName()] = o
+	return o
+}
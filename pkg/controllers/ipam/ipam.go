@@ -20,51 +20,174 @@ package controllers
 
 import (
 	"fmt"
+	"net"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile/reconcilers"
 	"github.com/gardener/controller-manager-library/pkg/logger"
 	"github.com/gardener/controller-manager-library/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 
 	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/apis/ipam/validation"
 	"github.com/mandelsoft/kubipam/pkg/ipam"
+	"github.com/mandelsoft/kubipam/pkg/metrics"
 )
 
 type IPAM struct {
 	lock      sync.RWMutex
 	object    resources.Object
-	ipam      *ipam.IPAM
+	ipams     []*ipam.IPAM // one ipam per ip family in order of the ranges
 	chunksize int
 	error     string
 	deleted   bool
+	pending   ipam.CIDRList
+	reserved  ipam.IPRanges
+	cooling   []api.IPAMRangeCooling
+	observer  ipam.Observer
+	owners    map[string]resources.ObjectName // owning objects of allocated cidrs
+
+	// checkpoint verification done during the setup
+	restored   []string
+	duplicates []string
+	condition  *api.IPAMRangeCondition
+
+	// results of the consistency check
+	suspects  map[string]bool
+	conflicts []string
+	orphans   []string
+}
+
+// newIPAMs creates an ipam for every ip family used by the given ranges.
+func newIPAMs(ranges ipam.IPRanges, spec *api.IPAMRangeSpec, observer ipam.Observer) ([]*ipam.IPAM, error) {
+	var ipams []*ipam.IPAM
+	for _, f := range ranges.Families() {
+		ipr, err := ipam.NewIPAMForRanges(ranges.ForFamily(f))
+		if err != nil {
+			return nil, err
+		}
+		if err := configure(ipr, spec); err != nil {
+			return nil, err
+		}
+		ipr.SetObserver(observer)
+		ipams = append(ipams, ipr)
+	}
+	return ipams, nil
 }
 
 func (this *Reconciler) setupIPAM(logger logger.LogContext, obj resources.Object) (bool, error) {
-	r := obj.Data().(*api.IPAMRange)
+	r := obj.Data().(api.RangeObject)
 
-	o := &IPAM{object: obj, chunksize: r.Spec.ChunkSize}
+	o := &IPAM{object: obj, chunksize: r.GetSpec().ChunkSize, observer: metrics.Observer(obj.ObjectName())}
 	this.ipams[obj.ObjectName()] = o
 
-	ranges, err := ipam.ParseIPRanges(r.Spec.Ranges...)
+	ranges, err := ipam.ParseIPRanges(r.GetRanges()...)
 	if err != nil {
 		o.error = err.Error()
 		return true, err
 	}
-	ipr, err := ipam.NewIPAMForRanges(ranges)
+	o.reserved, err = ipam.ParseIPRanges(r.GetSpec().Reserved...)
 	if err != nil {
 		o.error = err.Error()
 		return true, err
 	}
-	if r.Spec.Mode == api.MODE_ROUNDROBIN {
-		ipr.SetRoundRobin(true)
-		ipr.SetState(nil, r.GetState())
-	} else {
-		ipr.SetRoundRobin(false)
+	o.cooling = r.GetStatus().Cooling
+	// ranges pending for deletion are still required to
+	// replay the allocations of the requests. They are
+	// deleted again after the requests have been set up.
+	o.pending = r.GetDeletePending()
+	for _, c := range o.pending {
+		ranges = append(ranges, ipam.CIDRRange(c))
+	}
+	ipams, err := newIPAMs(ranges, r.GetSpec(), o.observer)
+	if err != nil {
+		o.error = err.Error()
+		return true, err
+	}
+	if r.GetSpec().Mode == api.MODE_ROUNDROBIN {
+		for _, ipr := range ipams {
+			ipr.SetState(nil, r.GetState(ipr.Bits()))
+		}
+	}
+	o.ipams = ipams
+	if r.GetSpec().Checkpoint != "" {
+		o.restored, err = this.readCheckpoint(obj)
+		if err != nil {
+			logger.Errorf("cannot read checkpoint: %s", err)
+		}
 	}
-	o.ipam = ipr
 	return true, nil
 }
 
+func (this *Reconciler) setupPending() {
+	for n, o := range this.ipams {
+		// cooling cidrs of released allocations are restored
+		// before the pending ranges are deleted.
+		o.restoreCooling(this.Controller())
+		for _, ipr := range o.ipams {
+			pending := o.pending.ForFamily(ipr.Family())
+			if len(pending) > 0 {
+				this.Controller().Infof("deleting pending ranges %s for %s", pending, n)
+				ipr.DeleteCIDRs(pending)
+			}
+		}
+		o.pending = nil
+		// reserved addresses are applied after the replay of the
+		// requests to keep already allocated addresses.
+		o.setReserved(this.Controller(), o.reserved)
+	}
+}
+
+// rangeName determines the object name of a referenced IPAMRange.
+// Without namespace the namespace of the referencing object is used.
+// ClusterIPAMRanges are identified by an object name without namespace.
+func rangeName(ref *api.IPAMReference, obj resources.Object) resources.ObjectName {
+	if ref.IsCluster() {
+		return resources.NewObjectName("", ref.Name)
+	}
+	if ref.Namespace == "" {
+		return resources.NewObjectName(obj.GetNamespace(), ref.Name)
+	}
+	return resources.NewObjectName(ref.Namespace, ref.Name)
+}
+
+// rangeKey determines the object key for the object name of a range.
+func (this *Reconciler) rangeKey(name resources.ObjectName) resources.ClusterObjectKey {
+	if name.Namespace() == "" {
+		return this.NewClusterObjectKey(api.CLUSTERIPAMRANGE, name)
+	}
+	return this.NewClusterObjectKey(api.IPAMRANGE, name)
+}
+
+// enqueueWaiting enqueues the requests and sub ranges of a range waiting
+// for free space. Objects not found in the cache are skipped.
+func (this *Reconciler) enqueueWaiting(key resources.ClusterObjectKey) {
+	for k := range this.GetUsersFor(key) {
+		obj, err := this.Controller().GetCachedObject(k)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				this.Controller().EnqueueKey(k)
+			}
+			continue
+		}
+		var state string
+		switch o := obj.Data().(type) {
+		case *api.IPAMRequest:
+			state = o.Status.State
+		case api.RangeObject:
+			state = o.GetStatus().State
+		}
+		if state == api.STATE_BUSY || state == api.STATE_QUOTAEXCEEDED {
+			this.Controller().EnqueueKey(k)
+		}
+	}
+}
+
 func (this *Reconciler) getRange(name resources.ObjectName) *IPAM {
 	this.lock.RLock()
 	defer this.lock.RUnlock()
@@ -77,6 +200,24 @@ func (this *Reconciler) setRange(name resources.ObjectName, ipr *IPAM) {
 	this.ipams[name] = ipr
 }
 
+// VisitRanges provides the ipams of all ranges for the range metrics.
+func (this *Reconciler) VisitRanges(visitor metrics.RangeVisitor) {
+	this.lock.RLock()
+	ranges := make([]*IPAM, 0, len(this.ipams))
+	for _, o := range this.ipams {
+		ranges = append(ranges, o)
+	}
+	this.lock.RUnlock()
+
+	for _, o := range ranges {
+		o.lock.RLock()
+		for _, ipr := range o.ipams {
+			visitor(o.object.ObjectName(), ipr)
+		}
+		o.lock.RUnlock()
+	}
+}
+
 func (this *Reconciler) reconcileRange(logger logger.LogContext, obj resources.Object) reconcile.Status {
 	old := this.getRange(obj.ObjectName())
 
@@ -85,30 +226,41 @@ func (this *Reconciler) reconcileRange(logger logger.LogContext, obj resources.O
 	} else {
 		logger.Infof("reconcile new")
 	}
-	r := obj.Data().(*api.IPAMRange)
-	ranges, err := ipam.ParseIPRanges(r.Spec.Ranges...)
+	r := obj.Data().(api.RangeObject)
 
-	roundRobin := false
+	err := validation.ValidateIPAMRange(r)
 	if err == nil {
-		switch r.Spec.Mode {
-		case "", api.MODE_FIRSTMATCH:
-			roundRobin = false
-		case api.MODE_ROUNDROBIN:
-			roundRobin = true
-		default:
-			err = fmt.Errorf("invalid mode %q: use %s or %s", r.Spec.Mode, api.MODE_FIRSTMATCH, api.MODE_ROUNDROBIN)
+		err = this.updateParent(obj)
+	}
+	if err == nil && r.GetSpec().Parent != nil {
+		denied, lerr := this.checkParentNamespace(obj)
+		if lerr != nil {
+			return reconcile.Delay(logger, lerr)
+		}
+		err = denied
+	}
+	cidrs := r.GetRanges()
+	if err == nil && r.GetSpec().Parent != nil && len(cidrs) == 0 {
+		var status reconcile.Status
+		var ok bool
+		cidrs, status, ok = this.allocateFromParent(logger, obj)
+		if !ok {
+			return status
 		}
 	}
 
-	var ipr *ipam.IPAM
+	var ranges, reserved ipam.IPRanges
+	if err == nil {
+		ranges, err = ipam.ParseIPRanges(cidrs...)
+	}
 	if err == nil {
-		ipr, err = ipam.NewIPAMForRanges(ranges)
+		reserved, err = ipam.ParseIPRanges(r.GetSpec().Reserved...)
 	}
 
+	var ipams []*ipam.IPAM
+	observer := metrics.Observer(obj.ObjectName())
 	if err == nil {
-		if ipr.Bits() < r.Spec.ChunkSize {
-			err = fmt.Errorf("chunk size %d too large: network %d", r.Spec.ChunkSize, ipr.Bits())
-		}
+		ipams, err = newIPAMs(ranges, r.GetSpec(), observer)
 	}
 
 	if err != nil {
@@ -118,24 +270,38 @@ func (this *Reconciler) reconcileRange(logger logger.LogContext, obj resources.O
 		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, err.Error()))
 	}
 
+	ipr := old
+	changed := true
 	if old == nil {
-		new := &IPAM{
+		ipr = &IPAM{
 			object:    obj,
-			ipam:      ipr,
-			chunksize: r.Spec.ChunkSize,
+			ipams:     ipams,
+			chunksize: r.GetSpec().ChunkSize,
 			error:     "",
+			observer:  observer,
 		}
-		new.lock.Lock()
-		defer new.lock.Unlock()
-		this.setRange(obj.ObjectName(), new)
-		new.ipam.SetRoundRobin(roundRobin)
+		ipr.lock.Lock()
+		defer ipr.lock.Unlock()
+		this.setRange(obj.ObjectName(), ipr)
 	} else {
 		old.lock.Lock()
 		defer old.lock.Unlock()
+		if err := old.updateRanges(logger, ranges); err != nil {
+			old.error = err.Error()
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, err.Error()))
+		}
+		if err := old.configure(r.GetSpec()); err != nil {
+			old.error = err.Error()
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, err.Error()))
+		}
+		this.checkAllowedNamespaces(old.object, obj)
+		changed = !reflect.DeepEqual(old.object.Data().(api.RangeObject).GetRanges(), cidrs)
 		old.object = obj
-		old.chunksize = r.Spec.ChunkSize
-		old.ipam.SetRoundRobin(roundRobin)
+		old.chunksize = r.GetSpec().ChunkSize
+		old.error = ""
 	}
+	ipr.reserved = reserved
+	ipr.setReserved(logger, reserved)
 	if len(this.GetUsersFor(obj.ClusterKey())) > 0 {
 		if !this.Controller().HasFinalizer(obj) {
 			logger.Infof("setting finalizer because of pending requests")
@@ -144,18 +310,430 @@ func (this *Reconciler) reconcileRange(logger logger.LogContext, obj resources.O
 			}
 		}
 	}
-	if r.Spec.Mode == "" {
-		mode := api.MODE_FIRSTMATCH
-		if ipr.IsRoundRobin() {
-			mode = api.MODE_ROUNDROBIN
-		}
+	if r.GetSpec().Mode == "" {
 		reconcile.Update(logger, resources.NewUpdater(obj, func(mod *resources.ModificationState) error {
-			r := mod.Data().(*api.IPAMRange)
-			mod.AssureStringValue(&r.Spec.Mode, mode)
+			r := mod.Data().(api.RangeObject)
+			mod.AssureStringValue(&r.GetSpec().Mode, api.MODE_FIRSTMATCH)
 			return nil
 		}))
 	}
-	return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_READY, ""))
+	freed := ipr.expireCooling(logger)
+	ipr.writeCheckpoint(logger)
+	if changed {
+		// changed ranges may affect all requests and sub ranges
+		this.EnqueueKeys(this.GetUsersFor(obj.ClusterKey()))
+	} else if freed {
+		// expired cooldowns may provide space for waiting requests
+		this.enqueueWaiting(obj.ClusterKey())
+	}
+	var reschedule []time.Duration
+	if d := ipr.nextCoolingExpiry(); d > 0 {
+		reschedule = append(reschedule, d)
+	}
+	return reconcile.UpdateStatus(logger, newRangeStatusUpdate(logger, obj, ipr, this.conflictMessage(obj.ClusterKey())), reschedule...)
+}
+
+// updateRanges applies changes of the configured ranges to an existing ipam.
+// Ranges still used by allocations are kept pending until they are released.
+// The ipam for an ip family is removed once it does not provide any range
+// anymore.
+func (this *IPAM) updateRanges(logger logger.LogContext, ranges ipam.IPRanges) error {
+	for _, f := range ranges.Families() {
+		if this.forFamily(f) == nil {
+			ipr, err := ipam.NewIPAMForRanges(ranges.ForFamily(f))
+			if err != nil {
+				return err
+			}
+			ipr.SetObserver(this.observer)
+			logger.Infof("adding %s ranges %s", f, ipr.Ranges())
+			this.ipams = append(this.ipams, ipr)
+		}
+	}
+
+	ipams := []*ipam.IPAM{}
+	for _, f := range append(ranges.Families(), ipam.IPv4, ipam.IPv6) {
+		ipr := this.forFamily(f)
+		if ipr == nil || containsIPAM(ipams, ipr) {
+			continue
+		}
+		cidrs, err := ipam.Includes(ranges.ForFamily(f)...)
+		if err != nil {
+			return err
+		}
+		cidrs.Sort()
+		added, deleted := ipr.Ranges().DiffTo(cidrs)
+		if len(added) > 0 {
+			logger.Infof("adding ranges %s", added)
+			ipr.AddCIDRs(added)
+		}
+		if len(deleted) > 0 {
+			logger.Infof("deleting ranges %s", deleted)
+			ipr.DeleteCIDRs(deleted)
+		}
+		if len(ipr.Ranges()) == 0 && len(ipr.PendingDeleted()) == 0 {
+			logger.Infof("no more %s ranges", f)
+			continue
+		}
+		ipams = append(ipams, ipr)
+	}
+	this.ipams = ipams
+	return nil
+}
+
+func containsIPAM(list []*ipam.IPAM, ipr *ipam.IPAM) bool {
+	for _, e := range list {
+		if e == ipr {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *IPAM) forFamily(family string) *ipam.IPAM {
+	for _, ipr := range this.ipams {
+		if ipr.Family() == family {
+			return ipr
+		}
+	}
+	return nil
+}
+
+func (this *IPAM) forCIDR(cidr *net.IPNet) *ipam.IPAM {
+	return this.forFamily(ipam.CIDRFamily(cidr))
+}
+
+func (this *IPAM) configure(spec *api.IPAMRangeSpec) error {
+	for _, ipr := range this.ipams {
+		if err := configure(ipr, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configure sets the allocation policies of an ipam. Modes other
+// than FirstMatch and RoundRobin are provided by allocation strategies.
+func configure(ipr *ipam.IPAM, spec *api.IPAMRangeSpec) error {
+	ipr.SetRoundRobin(spec.Mode == api.MODE_ROUNDROBIN)
+	ipr.SetStrategy(ipam.GetStrategy(spec.Mode))
+	ipr.SetHashed(spec.Mode == api.MODE_HASHED)
+	boundary := 0
+	if spec.AvoidBoundaryAddresses != "" {
+		b, err := ipam.ParseBoundary(spec.AvoidBoundaryAddresses)
+		if err != nil {
+			return err
+		}
+		boundary = b
+	}
+	ipr.SetReleaseCooldown(0)
+	if spec.ReleaseCooldown != nil {
+		ipr.SetReleaseCooldown(spec.ReleaseCooldown.Duration)
+	}
+	return ipr.SetAvoidBoundaryAddresses(boundary)
+}
+
+// setReserved applies the reserved addresses to the ipams of all ip
+// families. Reserved addresses still allocated are reported, they are
+// reserved as soon as they are released.
+func (this *IPAM) setReserved(logger logger.LogContext, reserved ipam.IPRanges) {
+	for _, ipr := range this.ipams {
+		cidrs, err := ipam.Includes(reserved.ForFamily(ipr.Family())...)
+		if err != nil {
+			logger.Errorf("invalid reserved addresses: %s", err)
+			continue
+		}
+		if pending := ipr.SetReserved(cidrs); len(pending) > 0 {
+			logger.Warnf("reserved addresses %s still allocated", pending)
+			this.object.Eventf(corev1.EventTypeWarning, "reserved", "reserved addresses %s still allocated", pending)
+		}
+	}
+}
+
+// reservedCIDRs returns the reserved cidrs of all ip families.
+func (this *IPAM) reservedCIDRs() []string {
+	var reserved []string
+	for _, ipr := range this.ipams {
+		reserved = append(reserved, assignedCIDRs(ipr.Reserved())...)
+	}
+	return reserved
+}
+
+// revert releases the given cidrs of a failed allocation in the ipams
+// of their ip families ignoring the release cooldown.
+func (this *IPAM) revert(cidrs []*net.IPNet) {
+	for _, c := range cidrs {
+		if ipr := this.forCIDR(c); ipr != nil {
+			ipr.Revert(c)
+		}
+		delete(this.owners, c.String())
+	}
+}
+
+// free releases the given cidrs in the ipams of their ip families.
+func (this *IPAM) free(cidrs []*net.IPNet) {
+	for _, c := range cidrs {
+		if ipr := this.forCIDR(c); ipr != nil {
+			ipr.Free(c)
+		}
+		delete(this.owners, c.String())
+	}
+}
+
+// unfree undoes the release of the given cidrs still used by an object.
+// A pending release cooldown is cancelled, otherwise the cidrs are
+// marked as busy again.
+func (this *IPAM) unfree(owner resources.ObjectName, cidrs []*net.IPNet) {
+	for _, c := range cidrs {
+		if ipr := this.forCIDR(c); ipr != nil {
+			if !ipr.CancelCooling(c) {
+				ipr.Busy(c)
+			}
+		}
+	}
+	this.setOwner(owner, cidrs...)
+}
+
+func assignedCIDRs(cidrs []*net.IPNet) []string {
+	list := []string{}
+	for _, c := range cidrs {
+		list = append(list, c.String())
+	}
+	return list
+}
+
+// pendingDeleted returns the deleted ranges of all ip families still
+// used by allocations.
+func (this *IPAM) pendingDeleted() ipam.CIDRList {
+	var pending ipam.CIDRList
+	for _, ipr := range this.ipams {
+		pending = append(pending, ipr.PendingDeleted()...)
+	}
+	return pending
+}
+
+// roundRobinState returns the round robin state of all ip families
+// as used by the status of an IPAMRange.
+func (this *IPAM) roundRobinState() []string {
+	state := []string{}
+	for _, ipr := range this.ipams {
+		_, cur := ipr.State()
+		for i := 0; i < len(cur); i++ {
+			if cur[i] != nil {
+				state = append(state, fmt.Sprintf("%s/%d", cur[i], i))
+			}
+		}
+	}
+	return state
+}
+
+// usage returns the utilization of all ip families as used by the
+// status of an IPAMRange together with a short summary of the free space.
+func (this *IPAM) usage() (string, []api.IPAMRangeUsage) {
+	var summary []string
+	var usage []api.IPAMRangeUsage
+	for _, ipr := range this.ipams {
+		stats := ipr.Stats()
+		u := api.IPAMRangeUsage{
+			Family:        ipr.Family(),
+			Total:         stats.Total.String(),
+			Used:          stats.Used.String(),
+			Reserved:      stats.Reserved.String(),
+			Cooling:       stats.Cooling.String(),
+			Free:          stats.Free.String(),
+			Fragmentation: fmt.Sprintf("%.2f", stats.Fragmentation),
+		}
+		if stats.LargestFree >= 0 {
+			u.LargestFree = fmt.Sprintf("/%d", stats.LargestFree)
+			summary = append(summary, fmt.Sprintf("%s (%s)", u.Free, u.LargestFree))
+		} else {
+			summary = append(summary, u.Free)
+		}
+		usage = append(usage, u)
+	}
+	return strings.Join(summary, ", "), usage
+}
+
+// requestFamilies determines the ip families to allocate for a request.
+// If no families are requested explicitly, the family of a requested
+// cidr or the first family of the range is used.
+func (this *IPAM) requestFamilies(families []string, spec ipam.RequestSpec) ([]string, error) {
+	if len(families) == 0 {
+		switch {
+		case spec != nil && spec.IsCIDR():
+			families = []string{ipam.BitsFamily(spec.Bits())}
+		case len(this.ipams) > 0:
+			families = []string{this.ipams[0].Family()}
+		default:
+			return nil, fmt.Errorf("no ranges configured")
+		}
+	}
+	for _, f := range families {
+		if this.forFamily(f) == nil {
+			return nil, fmt.Errorf("no %s ranges configured", f)
+		}
+	}
+	return families, nil
+}
+
+// requestSizes determines the netmask size to allocate for every requested
+// ip family. If no size is given, the chunk size of the range or a single
+// address is used.
+func (this *IPAM) requestSizes(families []string, size int) ([]int, error) {
+	sizes := make([]int, len(families))
+	for i, f := range families {
+		pool := this.forFamily(f)
+		if size > pool.Bits() {
+			return nil, fmt.Errorf("size %d too large: network %d", size, pool.Bits())
+		}
+		sizes[i] = size
+		if sizes[i] <= 0 {
+			sizes[i] = this.chunksize
+		}
+		if sizes[i] <= 0 {
+			sizes[i] = pool.Bits()
+		}
+	}
+	return sizes, nil
+}
+
+// allocate allocates a cidr for every requested ip family. Either all
+// allocations succeed or none is kept. An invalid request spec is reported
+// by invalid, an allocation failing because of exhausted ranges by busy.
+// The key of the requesting object determines the preferred cidr
+// in hashed mode.
+// A count larger than one allocates multiple, optionally contiguous, cidrs
+// of the requested size for a single ip family.
+func (this *IPAM) allocate(spec ipam.RequestSpec, families []string, sizes []int, count int, contiguous bool, key string) (cidrs []*net.IPNet, invalid error, busy error) {
+	if count > 1 && spec == nil && len(families) == 1 {
+		cidrs = this.forFamily(families[0]).AllocMultiple(key, sizes[0], count, contiguous)
+		if cidrs == nil {
+			if contiguous {
+				return nil, nil, fmt.Errorf("allocation of %d contiguous cidrs with size %d failed", count, sizes[0])
+			}
+			return nil, nil, fmt.Errorf("allocation of %d cidrs with size %d failed", count, sizes[0])
+		}
+		return cidrs, nil, nil
+	}
+	for i, f := range families {
+		pool := this.forFamily(f)
+		var cidr *net.IPNet
+		if spec != nil {
+			cidr, invalid = pool.AllocSpec(spec, key)
+			if invalid != nil {
+				this.revert(cidrs)
+				return nil, fmt.Errorf("invalid request %q: %s", spec, invalid), nil
+			}
+			if cidr == nil {
+				if spec.IsCIDR() {
+					busy = fmt.Errorf("%s already busy", spec)
+				} else {
+					busy = fmt.Errorf("allocation for request %s failed", spec)
+				}
+			}
+		} else {
+			cidr = pool.AllocFor(key, sizes[i])
+			if cidr == nil {
+				busy = fmt.Errorf("allocation with size %d failed", sizes[i])
+			}
+		}
+		if cidr == nil {
+			if len(families) > 1 {
+				busy = fmt.Errorf("%s %s", f, busy)
+			}
+			this.revert(cidrs)
+			return nil, nil, busy
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil, nil
+}
+
+// updateState updates the round robin state and the utilization
+// in the status of the range object.
+func (this *IPAM) updateState(logger logger.LogContext) {
+	_, err := resources.ModifyStatus(this.object, func(mod *resources.ModificationState) error {
+		r := mod.Object().Data().(api.RangeObject)
+
+		state := this.roundRobinState()
+		if !reflect.DeepEqual(state, r.GetStatus().RoundRobin) {
+			r.GetStatus().RoundRobin = state
+			mod.Modify(true)
+		}
+		this.updateUsage(mod)
+		this.updateCheckpoint(mod)
+		return nil
+	})
+	this.writeCheckpoint(logger)
+	if err != nil {
+		this.object.Event(corev1.EventTypeWarning, "allocation", fmt.Sprintf("allocation state update failed: %s", err.Error()))
+		logger.Errorf(fmt.Sprintf("allocation state update failed: %s", err.Error()))
+	}
+}
+
+// updateUsage updates the utilization in the status of the range object.
+func (this *IPAM) updateUsage(mod *resources.ModificationState) {
+	r := mod.Data().(api.RangeObject)
+	free, usage := this.usage()
+	mod.AssureStringValue(&r.GetStatus().Free, free)
+	if !reflect.DeepEqual(usage, r.GetStatus().Usage) {
+		r.GetStatus().Usage = usage
+		mod.Modify(true)
+	}
+	if reserved := this.reservedCIDRs(); !reflect.DeepEqual(reserved, r.GetStatus().Reserved) {
+		r.GetStatus().Reserved = reserved
+		mod.Modify(true)
+	}
+	if cooling := this.coolingState(); !reflect.DeepEqual(cooling, r.GetStatus().Cooling) {
+		r.GetStatus().Cooling = cooling
+		mod.Modify(true)
+	}
+	if namespaces := this.namespaceState(); !reflect.DeepEqual(namespaces, r.GetStatus().Namespaces) {
+		r.GetStatus().Namespaces = namespaces
+		mod.Modify(true)
+	}
+}
+
+func newRangeStatusUpdate(logger logger.LogContext, obj resources.Object, ipr *IPAM, conflict string) resources.ModificationStatusUpdater {
+	pending := []string{}
+	for _, c := range ipr.pendingDeleted() {
+		pending = append(pending, c.String())
+	}
+	state := api.STATE_READY
+	msg := ""
+	if len(pending) > 0 {
+		state = api.STATE_SHRINKING
+		msg = fmt.Sprintf("waiting for allocations in deleted ranges to be released: %s", strings.Join(pending, ", "))
+	}
+	if conflict != "" {
+		state = api.STATE_ERROR
+		msg = conflict
+	}
+	return resources.NewUpdater(obj, func(mod *resources.ModificationState) error {
+		r := mod.Data().(api.RangeObject)
+		if len(pending) == 0 {
+			pending = nil
+		}
+		if !reflect.DeepEqual(pending, r.GetStatus().DeletePending) {
+			r.GetStatus().DeletePending = pending
+			mod.Modify(true)
+		}
+		ipr.updateUsage(mod)
+		ipr.updateCheckpoint(mod)
+		if !reflect.DeepEqual(ipr.conflicts, r.GetStatus().Conflicts) {
+			r.GetStatus().Conflicts = ipr.conflicts
+			mod.Modify(true)
+		}
+		if !reflect.DeepEqual(ipr.orphans, r.GetStatus().Orphans) {
+			r.GetStatus().Orphans = ipr.orphans
+			mod.Modify(true)
+		}
+		mod.AssureStringValue(&r.GetStatus().State, state)
+		mod.AssureStringValue(&r.GetStatus().Message, msg)
+		if mod.IsModified() {
+			logger.Infof("updating state %s (%s)", state, msg)
+		}
+		return nil
+	})
 }
 
 func (this *Reconciler) deleteRange(logger logger.LogContext, obj resources.Object) reconcile.Status {
@@ -168,23 +746,28 @@ func (this *Reconciler) deleteRange(logger logger.LogContext, obj resources.Obje
 			old.deleted = true
 			old.error = "IPRange deleted"
 			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_DELETING,
-				"waiting for pending requests to be deleted"))
-		} else {
-			if this.Controller().HasFinalizer(obj) {
-				logger.Infof("removing finalizer because of no more requests")
-				if err := this.Controller().RemoveFinalizer(obj); err != nil {
-					return reconcile.Delay(logger, err)
-				}
-			}
+				"waiting for pending requests and ranges to be deleted"))
+		}
+	}
+	if err := this.releaseFromParent(logger, obj); err != nil {
+		return reconcile.Delay(logger, err)
+	}
+	if this.Controller().HasFinalizer(obj) {
+		logger.Infof("removing finalizer because of no more requests")
+		if err := this.Controller().RemoveFinalizer(obj); err != nil {
+			return reconcile.Delay(logger, err)
 		}
 	}
 	return reconcile.Succeeded(logger)
 }
 
 func (this *Reconciler) deletedRange(logger logger.LogContext, key resources.ClusterObjectKey) reconcile.Status {
+	this.CleanupUser(logger, "cleanup", this.Controller(), key, reconcilers.EnqueueAction)
 	this.lock.Lock()
 	defer this.lock.Unlock()
 	logger.Infof("finally delete state")
 	delete(this.ipams, key.ObjectName())
+	metrics.DeleteRange(key.ObjectName())
+	this.dropConflicts(key)
 	return reconcile.Succeeded(logger)
 }
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+)
+
+// handleLease renews the lease of the allocation of a request whenever
+// the heartbeat annotation changes and releases the allocation once the
+// lease has expired. It returns the time until the lease expires (0 for
+// requests without lease) and whether the allocation has been released.
+func (this *Reconciler) handleLease(logger logger.LogContext, obj resources.Object, ipr *IPAM) (time.Duration, bool, error) {
+	r := obj.Data().(*api.IPAMRequest)
+	if r.Spec.LeaseDuration == nil {
+		if r.Status.LeaseExpiresAt == nil {
+			return 0, false, nil
+		}
+		_, err := resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+			r := mod.Data().(*api.IPAMRequest)
+			if r.Status.LeaseExpiresAt != nil {
+				r.Status.LeaseExpiresAt = nil
+				mod.Modify(true)
+			}
+			mod.AssureStringValue(&r.Status.Heartbeat, "")
+			return nil
+		})
+		return 0, false, err
+	}
+
+	now := time.Now()
+	heartbeat := obj.GetAnnotations()[api.ANNOTATION_HEARTBEAT]
+	if r.Status.LeaseExpiresAt == nil || r.Status.Heartbeat != heartbeat {
+		expires := metav1.NewTime(now.Add(r.Spec.LeaseDuration.Duration))
+		_, err := resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+			r := mod.Data().(*api.IPAMRequest)
+			r.Status.LeaseExpiresAt = &expires
+			r.Status.Heartbeat = heartbeat
+			mod.Modify(true)
+			return nil
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		logger.Infof("lease renewed until %s", expires.Format(time.RFC3339))
+		return r.Spec.LeaseDuration.Duration, false, nil
+	}
+
+	if remaining := r.Status.LeaseExpiresAt.Sub(now); remaining > 0 {
+		return remaining, false, nil
+	}
+	return 0, true, this.expireRequest(logger, obj, ipr)
+}
+
+// expireRequest releases the allocation of a request with an expired lease.
+func (this *Reconciler) expireRequest(logger logger.LogContext, obj resources.Object, ipr *IPAM) error {
+	req := obj.Data().(*api.IPAMRequest)
+	var cidrs []*net.IPNet
+	for _, c := range req.GetCIDRs() {
+		_, cidr, err := net.ParseCIDR(c)
+		if err == nil {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	released := strings.Join(assignedCIDRs(cidrs), ", ")
+	logger.Infof("lease expired: releasing %s", released)
+	pending := len(ipr.pendingDeleted())
+	ipr.free(cidrs)
+	restored := this.restoreConflicts(ipr, obj.ClusterKey())
+	msg := fmt.Sprintf("lease expired at %s", req.Status.LeaseExpiresAt.Format(time.RFC3339))
+	_, err := resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+		mod.Set(assignedCIDRField, "")
+		r := mod.Data().(*api.IPAMRequest)
+		if r.Status.CIDRs != nil {
+			r.Status.CIDRs = nil
+			mod.Modify(true)
+		}
+		mod.AssureStringValue(&r.Status.State, api.STATE_EXPIRED)
+		mod.AssureStringValue(&r.Status.Message, msg)
+		return nil
+	})
+	if err != nil {
+		undoRestoreConflicts(ipr, restored)
+		ipr.unfree(obj.ObjectName(), cidrs)
+		ipr.object.Eventf(corev1.EventTypeWarning, "release", "release update failed: %s", err)
+		return err
+	}
+	ipr.updateState(logger)
+	obj.Eventf(corev1.EventTypeWarning, "lease", "%s: cidr %s released", msg, released)
+	ipr.object.Eventf(corev1.EventTypeNormal, "release", "cidr %s of expired request %s released", released, obj.ObjectName())
+	this.enqueueWaiting(ipr.object.ClusterKey())
+	if pending != len(ipr.pendingDeleted()) || ipr.isCooling() {
+		this.Controller().Enqueue(ipr.object)
+	}
+	return nil
+}
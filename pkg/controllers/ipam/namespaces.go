@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+)
+
+var NAMESPACE = resources.NewGroupKind("", "Namespace")
+
+// checkNamespace checks whether objects of a namespace are allowed to
+// allocate from a range. Objects of the namespace of the range itself
+// are always allowed.
+// It returns a denied error if the namespace is not allowed, an invalid
+// error for a malformed namespace selector of the range and a regular
+// error if the namespace could not be looked up.
+// The range must be locked.
+func (this *Reconciler) checkNamespace(ipr *IPAM, namespace string) (denied error, invalid error, err error) {
+	allowed := ipr.object.Data().(api.RangeObject).GetSpec().AllowedNamespaces
+	if allowed == nil || namespace == ipr.object.GetNamespace() {
+		return nil, nil, nil
+	}
+	for _, n := range allowed.Names {
+		if n == namespace {
+			return nil, nil, nil
+		}
+	}
+	if allowed.Selector != nil {
+		ok, invalid, err := this.matchNamespace(allowed.Selector, namespace)
+		if invalid != nil {
+			return nil, fmt.Errorf("IPAMRange %s: %s", ipr.object.ObjectName(), invalid), nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("IPAMRange %s: %s", ipr.object.ObjectName(), err)
+		}
+		if ok {
+			return nil, nil, nil
+		}
+	}
+	return fmt.Errorf("namespace %s not allowed to use IPAMRange %s", namespace, ipr.object.ObjectName()), nil, nil
+}
+
+// matchNamespace checks whether the labels of a namespace match
+// a label selector.
+// It returns an invalid error for a malformed selector and a
+// regular error if the namespace could not be looked up.
+func (this *Reconciler) matchNamespace(selector *metav1.LabelSelector, namespace string) (bool, error, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid namespace selector: %s", err), nil
+	}
+	resc, err := this.Controller().GetMainCluster().Resources().Get(NAMESPACE)
+	if err != nil {
+		return false, nil, err
+	}
+	ns, err := resc.GetCached(namespace)
+	if err != nil {
+		return false, nil, fmt.Errorf("namespace %s: %s", namespace, err)
+	}
+	return sel.Matches(labels.Set(ns.GetLabels())), nil, nil
+}
+
+// reconcileNamespace enqueues the requests and ranges of a namespace,
+// because a change of its labels may affect allowed namespaces and quotas
+// of the ranges they use.
+func (this *Reconciler) reconcileNamespace(logger logger.LogContext, obj resources.Object) reconcile.Status {
+	for _, gk := range []schema.GroupKind{api.IPAMREQUEST, api.IPAMRANGE} {
+		resc, err := this.Controller().GetMainCluster().Resources().Get(gk)
+		if err != nil {
+			return reconcile.Delay(logger, err)
+		}
+		list, err := resc.Namespace(obj.GetName()).ListCached(nil)
+		if err != nil {
+			return reconcile.Delay(logger, err)
+		}
+		for _, o := range list {
+			this.Controller().EnqueueKey(o.ClusterKey())
+		}
+	}
+	return reconcile.Succeeded(logger)
+}
+
+// checkAllowedNamespaces enqueues the requests and sub ranges of a range
+// if its allowed namespaces have been changed, so that they are verified
+// again.
+func (this *Reconciler) checkAllowedNamespaces(old, new resources.Object) {
+	o := old.Data().(api.RangeObject).GetSpec().AllowedNamespaces
+	n := new.Data().(api.RangeObject).GetSpec().AllowedNamespaces
+	if !reflect.DeepEqual(o, n) {
+		this.EnqueueKeys(this.GetUsersFor(new.ClusterKey()))
+	}
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// outputValues are the values derived from an allocated cidr.
+type outputValues struct {
+	CIDR         string
+	IP           string
+	LastIP       string
+	Gateway      string
+	Netmask      string
+	PrefixLength int
+	Family       string
+}
+
+// outputData is the data the templates of an output mapping are
+// evaluated for. The values of the first cidr are available directly,
+// the values of all cidrs with CIDRs.
+type outputData struct {
+	outputValues
+	Name      string
+	Namespace string
+	CIDRList  string
+	CIDRs     []outputValues
+}
+
+// defaultOutputMapping is used for a ConfigMap or Secret without
+// explicit mapping.
+var defaultOutputMapping = map[string]string{
+	"cidr":         "{{.CIDR}}",
+	"cidrs":        "{{.CIDRList}}",
+	"ip":           "{{.IP}}",
+	"gateway":      "{{.Gateway}}",
+	"netmask":      "{{.Netmask}}",
+	"prefixLength": "{{.PrefixLength}}",
+}
+
+func newOutputValues(cidr *net.IPNet) outputValues {
+	first := ipam.CIDRFirstIP(cidr)
+	v := outputValues{
+		CIDR:         cidr.String(),
+		IP:           first.String(),
+		LastIP:       ipam.CIDRLastIP(cidr).String(),
+		Netmask:      net.IP(cidr.Mask).String(),
+		PrefixLength: ipam.CIDRNetMaskSize(cidr),
+		Family:       ipam.CIDRFamily(cidr),
+	}
+	if ipam.CIDRHostMaskSize(cidr) > 1 {
+		// the first host address, networks with less than two host
+		// addresses have no gateway
+		v.Gateway = ipam.IPAdd(first, 1).String()
+	}
+	return v
+}
+
+func outputMapping(o *api.IPAMOutput) map[string]string {
+	if len(o.Mapping) == 0 && o.IsData() {
+		return defaultOutputMapping
+	}
+	return o.Mapping
+}
+
+// outputPath determines the field path of a mapping key.
+func outputPath(o *api.IPAMOutput, key string) []string {
+	if o.IsData() {
+		return []string{"data", key}
+	}
+	return strings.Split(key, ".")
+}
+
+// outputValuesFor evaluates the output mapping of a request
+// for its allocated cidrs.
+func outputValuesFor(r *api.IPAMRequest) (map[string]string, error) {
+	data := &outputData{
+		Name:      r.Name,
+		Namespace: r.Namespace,
+		CIDRList:  strings.Join(r.GetCIDRs(), ","),
+	}
+	for _, c := range r.GetCIDRs() {
+		_, cidr, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %s", c, err)
+		}
+		data.CIDRs = append(data.CIDRs, newOutputValues(cidr))
+	}
+	if len(data.CIDRs) > 0 {
+		data.outputValues = data.CIDRs[0]
+	}
+
+	values := map[string]string{}
+	for k, v := range outputMapping(r.Spec.Output) {
+		t, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %q: %s", k, err)
+		}
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, data); err != nil {
+			return nil, fmt.Errorf("template for %q failed: %s", k, err)
+		}
+		values[k] = buf.String()
+	}
+	return values, nil
+}
+
+// outputTarget provides the resource and an empty object for the
+// target object of an output.
+func (this *Reconciler) outputTarget(obj resources.Object, o *api.IPAMOutput) (resources.Interface, *unstructured.Unstructured, error) {
+	gv, err := schema.ParseGroupVersion(o.GetAPIVersion())
+	if err != nil {
+		return nil, nil, err
+	}
+	gvk := gv.WithKind(o.GetKind())
+	res, err := this.Controller().GetMainCluster().Resources().GetUnstructuredByGVK(gvk)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !res.Namespaced() {
+		return nil, nil, fmt.Errorf("%s is not namespaced", gvk.Kind)
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(obj.GetNamespace())
+	u.SetName(o.Name)
+	return res, u, nil
+}
+
+// ownedBy checks whether an object is owned by the object with the given uid.
+func ownedBy(obj metav1.Object, uid types.UID) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// updateOutput projects the allocation of a request into its output
+// object. A missing output object is created and owned by the request.
+// Existing objects not owned by the request are never modified.
+func (this *Reconciler) updateOutput(logger logger.LogContext, obj resources.Object) error {
+	r := obj.Data().(*api.IPAMRequest)
+	o := r.Spec.Output
+	if o == nil || len(r.GetCIDRs()) == 0 {
+		return nil
+	}
+	values, err := outputValuesFor(r)
+	if err != nil {
+		return err
+	}
+	res, target, err := this.outputTarget(obj, o)
+	if err != nil {
+		return err
+	}
+	secret := o.IsData() && o.GetKind() == "Secret"
+	_, mod, err := res.CreateOrModifyByName(target, func(data resources.ObjectData) (bool, error) {
+		u := data.(*unstructured.Unstructured)
+		mod := false
+		if u.GetResourceVersion() == "" {
+			u.SetOwnerReferences(append(u.GetOwnerReferences(), metav1.OwnerReference{
+				APIVersion: api.SchemeGroupVersion.String(),
+				Kind:       api.IPAMREQUEST.Kind,
+				Name:       r.Name,
+				UID:        r.UID,
+			}))
+			mod = true
+		} else if !ownedBy(u, r.UID) {
+			return false, fmt.Errorf("already exists and is not owned by the request")
+		}
+		for k, v := range values {
+			if secret {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			path := outputPath(o, k)
+			old, found, _ := unstructured.NestedString(u.Object, path...)
+			if !found || old != v {
+				if err := unstructured.SetNestedField(u.Object, v, path...); err != nil {
+					return false, fmt.Errorf("cannot set %q: %s", k, err)
+				}
+				mod = true
+			}
+		}
+		return mod, nil
+	})
+	if err != nil {
+		return fmt.Errorf("output %s %s: %s", o.GetKind(), o.Name, err)
+	}
+	if mod {
+		logger.Infof("updated output %s %s", o.GetKind(), o.Name)
+	}
+	return nil
+}
+
+// deleteOutput cleans up the output object of a request. Only an object
+// owned by the request is deleted, other objects are left untouched.
+func (this *Reconciler) deleteOutput(logger logger.LogContext, obj resources.Object) error {
+	r := obj.Data().(*api.IPAMRequest)
+	o := r.Spec.Output
+	if o == nil {
+		return nil
+	}
+	res, target, err := this.outputTarget(obj, o)
+	if err != nil {
+		return err
+	}
+	cur, err := res.Get(target)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !ownedBy(cur, r.UID) {
+		return nil
+	}
+	logger.Infof("deleting output %s %s", o.GetKind(), o.Name)
+	if err := cur.Delete(); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// setupParent replays the allocations of a range in its parent range
+// and reports the parent as used object.
+func (this *Reconciler) setupParent(sub resources.Object) resources.ClusterObjectKeySet {
+	r := sub.Data().(api.RangeObject)
+	if r.GetSpec().Parent == nil || r.GetSpec().Parent.Name == "" {
+		return nil
+	}
+	ref := rangeName(r.GetSpec().Parent, sub)
+	parent := this.ipams[ref]
+	if parent != nil {
+		for _, c := range r.GetStatus().CIDRs {
+			_, cidr, err := net.ParseCIDR(c)
+			if err != nil {
+				this.Controller().Errorf("invalid state of ipam range %s: invalid cidr: %s", sub.ObjectName(), c)
+				continue
+			}
+			if !parent.replay(sub, cidr) {
+				this.Controller().Errorf("invalid state of ipam range %s: no %s ranges in parent %s for cidr %s", sub.ObjectName(), ipam.CIDRFamily(cidr), ref, c)
+			}
+		}
+	}
+	return resources.NewClusterObjectKeySet(this.rangeKey(ref))
+}
+
+// updateParent registers the parent of a range as used object
+// and checks for cyclic parent relations.
+func (this *Reconciler) updateParent(obj resources.Object) error {
+	r := obj.Data().(api.RangeObject)
+	if r.GetSpec().Parent == nil {
+		this.UpdateFilteredUsesFor(obj.ClusterKey(), rangeFilter, nil)
+		return nil
+	}
+	ref := rangeName(r.GetSpec().Parent, obj)
+	this.UpdateFilteredUsesFor(obj.ClusterKey(), rangeFilter, resources.NewClusterObjectKeySet(this.rangeKey(ref)))
+
+	visited := map[resources.ObjectName]bool{obj.ObjectName(): true}
+	for {
+		if visited[ref] {
+			return fmt.Errorf("cyclic parent relation for IPAMRange %s", ref)
+		}
+		visited[ref] = true
+		parent := this.getRange(ref)
+		if parent == nil {
+			return nil
+		}
+		parent.lock.RLock()
+		p := parent.object.Data().(api.RangeObject)
+		if p.GetSpec().Parent != nil {
+			ref = rangeName(p.GetSpec().Parent, parent.object)
+		}
+		parent.lock.RUnlock()
+		if p.GetSpec().Parent == nil {
+			return nil
+		}
+	}
+}
+
+// checkParentNamespace checks whether the namespace of a range is allowed
+// to use its parent range. A regular error is returned if the namespace
+// could not be looked up.
+func (this *Reconciler) checkParentNamespace(obj resources.Object) (denied error, err error) {
+	r := obj.Data().(api.RangeObject)
+	parent := this.getRange(rangeName(r.GetSpec().Parent, obj))
+	if parent == nil {
+		return nil, nil
+	}
+	parent.lock.RLock()
+	defer parent.lock.RUnlock()
+	denied, invalid, err := this.checkNamespace(parent, obj.GetNamespace())
+	if invalid != nil {
+		return invalid, err
+	}
+	return denied, err
+}
+
+// allocateFromParent allocates the ranges of a range object from its
+// parent range. If the allocation is not possible, the returned status
+// must be used as result of the reconciliation.
+func (this *Reconciler) allocateFromParent(logger logger.LogContext, obj resources.Object) ([]string, reconcile.Status, bool) {
+	r := obj.Data().(api.RangeObject)
+	ref := rangeName(r.GetSpec().Parent, obj)
+
+	parent := this.getRange(ref)
+	if parent == nil {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, fmt.Sprintf("parent IPAMRange %s not found", ref))), false
+	}
+	if parent.error != "" {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, fmt.Sprintf("parent IPAMRange %s not valid: %s", ref, parent.error))), false
+	}
+
+	parent.lock.Lock()
+	defer parent.lock.Unlock()
+
+	var spec ipam.RequestSpec
+	if r.GetSpec().Request != "" {
+		var err error
+		spec, err = ipam.ParseRequestSpec(strings.TrimSpace(r.GetSpec().Request))
+		if err != nil {
+			return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID,
+				fmt.Sprintf("invalid request %q: %s", r.GetSpec().Request, err))), false
+		}
+	}
+	families, err := parent.requestFamilies(r.GetSpec().IPFamilies, spec)
+	if err != nil {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID,
+			fmt.Sprintf("parent IPAMRange %s: %s", ref, err))), false
+	}
+	sizes, err := parent.requestSizes(families, 0)
+	if err != nil {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, err.Error())), false
+	}
+	if err := this.Controller().SetFinalizer(obj); err != nil {
+		return nil, reconcile.Delay(logger, err), false
+	}
+	if !this.Controller().HasFinalizer(parent.object) {
+		logger.Infof("requesting finalizer for parent IPAM %s", ref)
+		if err := this.Controller().SetFinalizer(parent.object); err != nil {
+			return nil, reconcile.Delay(logger, err), false
+		}
+	}
+
+	cidrs, invalid, busy := parent.allocate(spec, families, sizes, 1, false, obj.ObjectName().String())
+	if invalid != nil {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, invalid.Error())), false
+	}
+	if busy != nil {
+		parent.object.Event(corev1.EventTypeWarning, "allocation", busy.Error())
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_BUSY, busy.Error()), 2*time.Minute), false
+	}
+	exceeded, invalid, err := this.checkQuota(parent, obj.ObjectName(), cidrs)
+	if exceeded != nil || invalid != nil || err != nil {
+		parent.revert(cidrs)
+	}
+	if err != nil {
+		return nil, reconcile.Delay(logger, err), false
+	}
+	if invalid != nil {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, invalid.Error())), false
+	}
+	if exceeded != nil {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_QUOTAEXCEEDED, exceeded.Error()), 2*time.Minute), false
+	}
+
+	assigned := assignedCIDRs(cidrs)
+	logger.Infof("allocated %s from parent %s", strings.Join(assigned, ", "), ref)
+	_, err = resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+		r := mod.Data().(api.RangeObject)
+		if !reflect.DeepEqual(assigned, r.GetStatus().CIDRs) {
+			r.GetStatus().CIDRs = assigned
+			mod.Modify(true)
+		}
+		return nil
+	})
+	if err != nil {
+		parent.revert(cidrs)
+		parent.object.Eventf(corev1.EventTypeWarning, "allocation", "allocation update failed: %s", err)
+		return nil, reconcile.Delay(logger, err), false
+	}
+	parent.setOwner(obj.ObjectName(), cidrs...)
+	parent.updateState(logger)
+	parent.object.Eventf(corev1.EventTypeNormal, "allocation", "cidr %s allocated for range %s", strings.Join(assigned, ", "), obj.ObjectName())
+	return assigned, reconcile.Succeeded(logger), true
+}
+
+// releaseFromParent releases the allocations of a range object
+// in its parent range.
+func (this *Reconciler) releaseFromParent(logger logger.LogContext, obj resources.Object) error {
+	r := obj.Data().(api.RangeObject)
+	if r.GetSpec().Parent == nil {
+		return nil
+	}
+	var cidrs []*net.IPNet
+	for _, c := range r.GetStatus().CIDRs {
+		_, cidr, err := net.ParseCIDR(c)
+		if err == nil {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	if len(cidrs) == 0 {
+		return nil
+	}
+	ref := rangeName(r.GetSpec().Parent, obj)
+	parent := this.getRange(ref)
+	if parent == nil {
+		return nil
+	}
+	parent.lock.Lock()
+	defer parent.lock.Unlock()
+	released := strings.Join(assignedCIDRs(cidrs), ", ")
+	logger.Infof("releasing %s in parent %s", released, ref)
+	pending := len(parent.pendingDeleted())
+	parent.free(cidrs)
+	restored := this.restoreConflicts(parent, obj.ClusterKey())
+	_, err := resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+		r := mod.Data().(api.RangeObject)
+		if r.GetStatus().CIDRs != nil {
+			r.GetStatus().CIDRs = nil
+			mod.Modify(true)
+		}
+		return nil
+	})
+	if err != nil {
+		undoRestoreConflicts(parent, restored)
+		parent.unfree(obj.ObjectName(), cidrs)
+		parent.object.Event(corev1.EventTypeWarning, "release", fmt.Sprintf("release update failed: %s", err))
+		return err
+	}
+	parent.updateState(logger)
+	parent.object.Event(corev1.EventTypeNormal, "release", fmt.Sprintf("cidr %s of range %s released", released, obj.ObjectName()))
+	this.enqueueWaiting(this.rangeKey(ref))
+	if pending != len(parent.pendingDeleted()) || parent.isCooling() {
+		this.Controller().Enqueue(parent.object)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/gardener/controller-manager-library/pkg/resources"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+// namespaceUsage describes the allocations of the objects
+// of a namespace in a range.
+type namespaceUsage struct {
+	objects   map[string]bool
+	addresses ipam.Int
+}
+
+// setOwner records the object the given cidrs are allocated for.
+func (this *IPAM) setOwner(owner resources.ObjectName, cidrs ...*net.IPNet) {
+	if this.owners == nil {
+		this.owners = map[string]resources.ObjectName{}
+	}
+	for _, c := range cidrs {
+		this.owners[c.String()] = owner
+	}
+}
+
+// namespaceUsage determines the allocations per namespace.
+// Allocations of cluster scoped objects are not considered.
+func (this *IPAM) namespaceUsage() map[string]*namespaceUsage {
+	usage := map[string]*namespaceUsage{}
+	for c, owner := range this.owners {
+		if owner.Namespace() == "" {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		u := usage[owner.Namespace()]
+		if u == nil {
+			u = &namespaceUsage{objects: map[string]bool{}, addresses: ipam.IntZero}
+			usage[owner.Namespace()] = u
+		}
+		u.objects[owner.Name()] = true
+		u.addresses = u.addresses.Add(addresses(cidr))
+	}
+	return usage
+}
+
+// namespaceState returns the allocations per namespace
+// as used by the status of an IPAMRange.
+func (this *IPAM) namespaceState() []api.IPAMRangeNamespaceUsage {
+	var state []api.IPAMRangeNamespaceUsage
+	for ns, u := range this.namespaceUsage() {
+		state = append(state, api.IPAMRangeNamespaceUsage{
+			Namespace: ns,
+			Requests:  len(u.objects),
+			Addresses: u.addresses.String(),
+		})
+	}
+	sort.Slice(state, func(i, j int) bool { return state[i].Namespace < state[j].Namespace })
+	return state
+}
+
+// namespaceQuota determines the quota of a range applicable for a namespace.
+// It returns nil if the namespace is not restricted, an invalid error for
+// a malformed quota selector and a regular error if the namespace could
+// not be looked up.
+func (this *Reconciler) namespaceQuota(ipr *IPAM, namespace string) (*api.IPAMRangeQuota, error, error) {
+	quotas := ipr.object.Data().(api.RangeObject).GetSpec().Quotas
+	for i := range quotas {
+		q := &quotas[i]
+		if q.Namespace != "" {
+			if q.Namespace == namespace {
+				return q, nil, nil
+			}
+			continue
+		}
+		ok, invalid, err := this.matchNamespace(q.Selector, namespace)
+		if invalid != nil {
+			return nil, fmt.Errorf("IPAMRange %s: %s", ipr.object.ObjectName(), invalid), nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("IPAMRange %s: %s", ipr.object.ObjectName(), err)
+		}
+		if ok {
+			return q, nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// checkQuota checks whether the cidrs allocated for an object
+// exceed the quota of its namespace.
+// It returns an exceeded error if the quota is exceeded, an invalid error
+// for a malformed quota of the range and a regular error if the namespace
+// could not be looked up.
+// The range must be locked.
+func (this *Reconciler) checkQuota(ipr *IPAM, owner resources.ObjectName, cidrs []*net.IPNet) (exceeded error, invalid error, err error) {
+	if owner.Namespace() == "" {
+		return nil, nil, nil
+	}
+	quota, invalid, err := this.namespaceQuota(ipr, owner.Namespace())
+	if quota == nil || invalid != nil || err != nil {
+		return nil, invalid, err
+	}
+	requests := 1
+	used := ipam.IntZero
+	if u := ipr.namespaceUsage()[owner.Namespace()]; u != nil {
+		requests = len(u.objects)
+		if !u.objects[owner.Name()] {
+			requests++
+		}
+		used = u.addresses
+	}
+	for _, c := range cidrs {
+		used = used.Add(addresses(c))
+	}
+	if quota.Requests > 0 && requests > quota.Requests {
+		return fmt.Errorf("request quota %d of namespace %s exceeded in IPAMRange %s", quota.Requests, owner.Namespace(), ipr.object.ObjectName()), nil, nil
+	}
+	if quota.Addresses != "" {
+		limit, err := ipam.ParseInt(quota.Addresses)
+		if err != nil {
+			return nil, fmt.Errorf("IPAMRange %s: invalid address quota %q", ipr.object.ObjectName(), quota.Addresses), nil
+		}
+		if used.Cmp(limit) > 0 {
+			return fmt.Errorf("address quota %s of namespace %s exceeded in IPAMRange %s: %s addresses required",
+				quota.Addresses, owner.Namespace(), ipr.object.ObjectName(), used), nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// addresses returns the number of addresses of a cidr.
+func addresses(cidr *net.IPNet) ipam.Int {
+	ones, bits := cidr.Mask.Size()
+	return ipam.IntOne.LShift(uint(bits - ones))
+}
@@ -20,14 +20,17 @@ package controllers
 
 import (
 	"sync"
+	"time"
 
 	"github.com/gardener/controller-manager-library/pkg/config"
 	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
 	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile/reconcilers"
 	"github.com/gardener/controller-manager-library/pkg/logger"
 	"github.com/gardener/controller-manager-library/pkg/resources"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/metrics"
 )
 
 type Reconciler struct {
@@ -37,6 +40,9 @@ type Reconciler struct {
 
 	lock  sync.RWMutex
 	ipams map[resources.ObjectName]*IPAM
+
+	conflictLock sync.Mutex
+	conflicts    map[resources.ClusterObjectKey][]conflict
 }
 
 var _ reconcile.Interface = &Reconciler{}
@@ -50,19 +56,27 @@ func (this *Reconciler) Config() config.OptionSource {
 ///////////////////////////////////////////////////////////////////////////////
 
 func (this *Reconciler) Setup() {
-	resc, _ := this.Controller().GetMainCluster().Resources().Get(api.IPAMRANGE)
-	reconcilers.ProcessResource(this.Controller(), "setup", resc, this.setupIPAM)
-	resc, _ = this.Controller().GetMainCluster().Resources().Get(api.IPAMREQUEST)
+	for _, gk := range []schema.GroupKind{api.CLUSTERIPAMRANGE, api.IPAMRANGE} {
+		resc, _ := this.Controller().GetMainCluster().Resources().Get(gk)
+		reconcilers.ProcessResource(this.Controller(), "setup", resc, this.setupIPAM)
+		this.SimpleUsageCache.SetupFilteredFor(this.Controller(), resc, rangeFilter, this.setupParent)
+	}
+	resc, _ := this.Controller().GetMainCluster().Resources().Get(api.IPAMREQUEST)
 	this.SimpleUsageCache.SetupFor(this.Controller(), resc, this.setupRequest)
+	this.setupPending()
+	this.verifyCheckpoints()
 	this.Controller().Infof("setup done")
 }
 
 func (this *Reconciler) Reconcile(logger logger.LogContext, obj resources.Object) reconcile.Status {
 	switch obj.GroupKind() {
 	case api.IPAMREQUEST:
+		defer metrics.ObserveRequestReconcile(time.Now())
 		return this.reconcileRequest(logger, obj)
-	case api.IPAMRANGE:
+	case api.IPAMRANGE, api.CLUSTERIPAMRANGE:
 		return this.reconcileRange(logger, obj)
+	case NAMESPACE:
+		return this.reconcileNamespace(logger, obj)
 	}
 	return reconcile.Succeeded(logger)
 }
@@ -71,7 +85,7 @@ func (this *Reconciler) Delete(logger logger.LogContext, obj resources.Object) r
 	switch obj.GroupKind() {
 	case api.IPAMREQUEST:
 		return this.deleteRequest(logger, obj)
-	case api.IPAMRANGE:
+	case api.IPAMRANGE, api.CLUSTERIPAMRANGE:
 		return this.deleteRange(logger, obj)
 	}
 	return reconcile.Succeeded(logger)
@@ -79,7 +93,7 @@ func (this *Reconciler) Delete(logger logger.LogContext, obj resources.Object) r
 
 func (this *Reconciler) Deleted(logger logger.LogContext, key resources.ClusterObjectKey) reconcile.Status {
 	switch key.GroupKind() {
-	case api.IPAMRANGE:
+	case api.IPAMRANGE, api.CLUSTERIPAMRANGE:
 		return this.deletedRange(logger, key)
 	case api.IPAMREQUEST:
 		return this.deletedRequest(logger, key)
@@ -33,28 +33,34 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/apis/ipam/validation"
 	"github.com/mandelsoft/kubipam/pkg/ipam"
 )
 
 var assignedCIDRField = fieldpath.RequiredField(&api.IPAMRequest{}, ".Status.CIDR")
-var rangeFilter = resources.NewGroupKindFilter(api.IPAMRANGE)
+var rangeFilter = func(key resources.ClusterObjectKey) bool {
+	gk := key.GroupKind()
+	return gk == api.IPAMRANGE || gk == api.CLUSTERIPAMRANGE
+}
 
 func (this *Reconciler) setupRequest(sub resources.Object) resources.ClusterObjectKeySet {
 	req := sub.Data().(*api.IPAMRequest)
-	ref := req.Spec.IPAM.RelativeTo(sub)
+	ref := requestRange(req, sub)
 	if ref.Name() != "" {
-		ipam := this.ipams[ref]
-		if ipam != nil {
-			if req.Status.CIDR != "" {
-				_, cidr, err := net.ParseCIDR(req.Status.CIDR)
+		ipr := this.ipams[ref]
+		if ipr != nil {
+			for _, c := range req.GetCIDRs() {
+				_, cidr, err := net.ParseCIDR(c)
 				if err != nil {
-					this.Controller().Errorf("invalid state of ipam request %s: invalid cidr: %s", ref, req.Status.CIDR)
-				} else {
-					ipam.ipam.Busy(cidr)
+					this.Controller().Errorf("invalid state of ipam request %s: invalid cidr: %s", ref, c)
+					continue
+				}
+				if !ipr.replay(sub, cidr) {
+					this.Controller().Errorf("invalid state of ipam request %s: no %s ranges for cidr %s", ref, ipam.CIDRFamily(cidr), c)
 				}
 			}
 		}
-		return resources.NewClusterObjectKeySet(this.NewClusterObjectKey(api.IPAMRANGE, ref))
+		return resources.NewClusterObjectKeySet(this.rangeKey(ref))
 	}
 	return nil
 }
@@ -62,46 +68,70 @@ func (this *Reconciler) setupRequest(sub resources.Object) resources.ClusterObje
 func (this *Reconciler) reconcileRequest(logger logger.LogContext, obj resources.Object) reconcile.Status {
 	r := obj.Data().(*api.IPAMRequest)
 
-	ref := r.Spec.IPAM.RelativeTo(obj)
-
-	if ref.Name() == "" {
-		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, "IPAMRange object not specified"))
+	if err := validation.ValidateIPAMRequest(r); err != nil {
+		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, err.Error()))
 	}
 
-	/*
-		if r.Spec.Request != "" {
-			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, "request field not implemented yet"))
-		}
-	*/
+	ref := requestRange(r, obj)
 
-	this.UpdateFilteredUsesFor(obj.ClusterKey(), rangeFilter, resources.NewClusterObjectKeySet(this.NewClusterObjectKey(api.IPAMRANGE, ref)))
-	ipr := this.getRange(ref)
-	if ipr == nil {
-		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, fmt.Sprintf("IPAMRange %s not found", ref)))
+	used := resources.NewClusterObjectKeySet()
+	if ref.Name() != "" {
+		used.Add(this.rangeKey(ref))
+	} else {
+		// all ranges of the ipams list are protected until one is chosen
+		for _, n := range candidateNames(r, obj) {
+			used.Add(this.rangeKey(n))
+		}
+	}
+	this.UpdateFilteredUsesFor(obj.ClusterKey(), rangeFilter, used)
+	if r.Status.State == api.STATE_EXPIRED && r.Status.CIDR == "" {
+		// the allocation of an expired request is never renewed,
+		// the cleanup of its output is retried until it succeeds
+		return reconcile.DelayOnError(logger, this.deleteOutput(logger, obj))
 	}
-	if ipr.error != "" {
-		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, fmt.Sprintf("IPAMRange %s not valid: %s", ref, ipr.error)))
+
+	var ipr *IPAM
+	if ref.Name() == "" {
+		// the range is chosen together with the first allocation
+		var status reconcile.Status
+		var ok bool
+		ipr, status, ok = this.selectRange(logger, obj)
+		if !ok {
+			return status
+		}
+		ref = ipr.object.ObjectName()
+		this.UpdateFilteredUsesFor(obj.ClusterKey(), rangeFilter, resources.NewClusterObjectKeySet(this.rangeKey(ref)))
+		r = obj.Data().(*api.IPAMRequest)
+	} else {
+		ipr = this.getRange(ref)
+		if ipr == nil {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, fmt.Sprintf("IPAMRange %s not found", ref)))
+		}
+		if ipr.error != "" {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, fmt.Sprintf("IPAMRange %s not valid: %s", ref, ipr.error)))
+		}
 	}
 
 	ipr.lock.Lock()
 	defer ipr.lock.Unlock()
+	// the namespace is a precondition for new allocations, existing
+	// allocations are still maintained if it is not allowed anymore
+	denied, invalid, lerr := this.checkNamespace(ipr, obj.GetNamespace())
 	if r.Status.CIDR == "" {
-		size := r.Spec.Size
-		if size < 0 {
-			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID,
-				fmt.Sprintf("invalid size %d", size)))
+		if lerr != nil {
+			return reconcile.Delay(logger, lerr)
 		}
-		if size > ipr.ipam.Bits() {
-			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID,
-				fmt.Sprintf("size %d too large: network %d", size, ipr.ipam.Bits())))
+		if invalid != nil {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_ERROR, invalid.Error()))
 		}
-		if size <= 0 {
-			size = ipr.chunksize
+		if denied != nil {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, denied.Error()))
 		}
-		if size <= 0 {
-			size = ipr.ipam.Bits()
+		spec, families, sizes, err := requestAllocation(r, ipr)
+		if err != nil {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, err.Error()))
 		}
-		err := this.Controller().SetFinalizer(obj)
+		err = this.Controller().SetFinalizer(obj)
 		if err != nil {
 			return reconcile.Delay(logger, err)
 		}
@@ -111,101 +141,168 @@ func (this *Reconciler) reconcileRequest(logger logger.LogContext, obj resources
 				return reconcile.Delay(logger, err)
 			}
 		}
-		var cidr *net.IPNet
-		if r.Spec.Request != "" {
-			var ip net.IP
-			cidr, err = ipam.ParseCIDR(strings.TrimSpace(r.Spec.Request))
-			if err != nil {
-				ip = ipam.ParseIP(strings.TrimSpace(r.Spec.Request))
-				if ip == nil {
-					return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID,
-						fmt.Sprintf("invalid request cidr or ip %s: %s", r.Spec.Request, err)))
-				}
-				cidr = ipam.IPtoCIDR(ip)
-			}
 
-			if !ipr.ipam.Busy(cidr) {
-				err = fmt.Errorf("%s already busy", cidr)
-				cidr = nil
-			}
-		} else {
-			cidr = ipr.ipam.Alloc(size)
-			if cidr == nil {
-				err = fmt.Errorf("allocation with size %d failed", size)
-			}
+		cidrs, invalid, busy := ipr.allocate(spec, families, sizes, r.Spec.Count, r.Spec.Contiguous, obj.ObjectName().String())
+		if invalid != nil {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, invalid.Error()))
 		}
-		if cidr != nil {
-			logger.Infof("allocated %s", cidr)
-			_, err := resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
-				mod.Set(assignedCIDRField, cidr.String())
-				return nil
-			})
-			if err != nil {
-				ipr.ipam.Free(cidr)
-				ipr.object.Eventf(corev1.EventTypeWarning, "allocation", "allocation update failed: %s", err)
-				return reconcile.Delay(logger, err)
-			}
-			_, err = resources.ModifyStatus(ipr.object, func(mod *resources.ModificationState) error {
-				r := mod.Object().Data().(*api.IPAMRange)
-
-				_, cur := ipr.ipam.State()
-				state := []string{}
-				for i := 0; i < len(cur); i++ {
-					if cur[i] != nil {
-						state = append(state, fmt.Sprintf("%s/%d", cur[i], i))
-					}
-				}
-				if !reflect.DeepEqual(state, r.Status.RoundRobin) {
-					r.Status.RoundRobin = state
-					mod.Modify(true)
-				}
-				return nil
-			})
-			if err != nil {
-				ipr.object.Event(corev1.EventTypeWarning, "allocation", fmt.Sprintf("allocation state update failed: %s", err.Error()))
-				logger.Errorf(fmt.Sprintf("allocation state update failed: %s", err.Error()))
-			}
-		} else {
-			this.EnqueueKeys(this.GetUsesFor(this.NewClusterObjectKey(api.IPAMRANGE, ref)))
-			ipr.object.Event(corev1.EventTypeWarning, "allocation", err.Error())
-			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_BUSY, err.Error()), 2*time.Minute)
+		if busy != nil {
+			this.EnqueueKeys(this.GetUsesFor(this.rangeKey(ref)))
+			ipr.object.Event(corev1.EventTypeWarning, "allocation", busy.Error())
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_BUSY, busy.Error()), 2*time.Minute)
 		}
-		ipr.object.Eventf(corev1.EventTypeNormal, "allocation", "cidr %s allocated", cidr)
+		exceeded, invalid, err := this.checkQuota(ipr, obj.ObjectName(), cidrs)
+		if exceeded != nil || invalid != nil || err != nil {
+			ipr.revert(cidrs)
+		}
+		if err != nil {
+			return reconcile.Delay(logger, err)
+		}
+		if invalid != nil {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_ERROR, invalid.Error()))
+		}
+		if exceeded != nil {
+			return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_QUOTAEXCEEDED, exceeded.Error()), 2*time.Minute)
+		}
+		if err := this.assignCIDRs(logger, obj, ipr, cidrs, ""); err != nil {
+			return reconcile.Delay(logger, err)
+		}
+	}
+	remaining, expired, err := this.handleLease(logger, obj, ipr)
+	if err != nil {
+		return reconcile.Delay(logger, err)
+	}
+	if expired {
+		return reconcile.DelayOnError(logger, this.deleteOutput(logger, obj))
+	}
+	var reschedule []time.Duration
+	if remaining > 0 {
+		reschedule = append(reschedule, remaining)
+	}
+	if err := this.updateOutput(logger, obj); err != nil {
+		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_ERROR, err.Error()), time.Minute)
+	}
+	if lerr != nil {
+		return reconcile.Delay(logger, lerr)
+	}
+	if invalid != nil {
+		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_ERROR, invalid.Error()), reschedule...)
+	}
+	if denied != nil {
+		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, denied.Error()), reschedule...)
+	}
+	if msg := this.conflictMessage(obj.ClusterKey()); msg != "" {
+		return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_ERROR, msg), reschedule...)
+	}
+	return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_READY, ""), reschedule...)
+}
+
+// requestAllocation determines the request spec, the ip families
+// and the netmask sizes to allocate for a request in a range.
+func requestAllocation(r *api.IPAMRequest, ipr *IPAM) (ipam.RequestSpec, []string, []int, error) {
+	var spec ipam.RequestSpec
+	if r.Spec.Request != "" {
+		var err error
+		spec, err = ipam.ParseRequestSpec(strings.TrimSpace(r.Spec.Request))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid request %q: %s", r.Spec.Request, err)
+		}
+	}
+	families, err := ipr.requestFamilies(r.Spec.IPFamilies, spec)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("IPAMRange %s: %s", ipr.object.ObjectName(), err)
 	}
-	return reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_READY, ""))
+	sizes, err := ipr.requestSizes(families, r.Spec.Size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return spec, families, sizes, nil
+}
+
+// assignCIDRs records the cidrs allocated for a request in its status
+// together with the name of a selected range. If the status cannot be
+// updated the allocation is reverted.
+func (this *Reconciler) assignCIDRs(logger logger.LogContext, obj resources.Object, ipr *IPAM, cidrs []*net.IPNet, selected string) error {
+	assigned := assignedCIDRs(cidrs)
+	logger.Infof("allocated %s", strings.Join(assigned, ", "))
+	_, err := resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+		mod.Set(assignedCIDRField, assigned[0])
+		r := mod.Data().(*api.IPAMRequest)
+		if !reflect.DeepEqual(assigned, r.Status.CIDRs) {
+			r.Status.CIDRs = assigned
+			mod.Modify(true)
+		}
+		if selected != "" {
+			mod.AssureStringValue(&r.Status.IPAM, selected)
+		}
+		return nil
+	})
+	if err != nil {
+		ipr.revert(cidrs)
+		ipr.object.Eventf(corev1.EventTypeWarning, "allocation", "allocation update failed: %s", err)
+		return err
+	}
+	ipr.setOwner(obj.ObjectName(), cidrs...)
+	ipr.updateState(logger)
+	ipr.object.Eventf(corev1.EventTypeNormal, "allocation", "cidr %s allocated", strings.Join(assigned, ", "))
+	return nil
 }
 
 func (this *Reconciler) deleteRequest(logger logger.LogContext, obj resources.Object) reconcile.Status {
 	if this.Controller().HasFinalizer(obj) {
 		req := obj.Data().(*api.IPAMRequest)
-		if req.Status.CIDR != "" {
-			_, cidr, err := net.ParseCIDR(req.Status.CIDR)
+		var cidrs []*net.IPNet
+		for _, c := range req.GetCIDRs() {
+			_, cidr, err := net.ParseCIDR(c)
 			if err == nil {
-				ref := req.Spec.IPAM.RelativeTo(obj)
-				ipr := this.getRange(ref)
-				if ipr != nil {
-					ipr.lock.Lock()
-					defer ipr.lock.Unlock()
-					logger.Infof("releasing %s", cidr)
-					ipr.ipam.Free(cidr)
-					_, err := resources.Modify(obj, func(mod *resources.ModificationState) error {
-						mod.Set(assignedCIDRField, "")
-						return nil
-					})
-					if err != nil {
-						ipr.ipam.Busy(cidr)
-						ipr.object.Event(corev1.EventTypeWarning, "release", fmt.Sprintf("release update failed: %s", err))
-						return reconcile.Delay(logger, err)
+				cidrs = append(cidrs, cidr)
+			}
+		}
+		if len(cidrs) > 0 {
+			ref := requestRange(req, obj)
+			ipr := this.getRange(ref)
+			if ipr != nil {
+				ipr.lock.Lock()
+				defer ipr.lock.Unlock()
+				released := strings.Join(assignedCIDRs(cidrs), ", ")
+				logger.Infof("releasing %s", released)
+				pending := len(ipr.pendingDeleted())
+				ipr.free(cidrs)
+				restored := this.restoreConflicts(ipr, obj.ClusterKey())
+				_, err := resources.Modify(obj, func(mod *resources.ModificationState) error {
+					mod.Set(assignedCIDRField, "")
+					r := mod.Data().(*api.IPAMRequest)
+					if r.Status.CIDRs != nil {
+						r.Status.CIDRs = nil
+						mod.Modify(true)
 					}
-					ipr.object.Event(corev1.EventTypeNormal, "release", fmt.Sprintf("cidr %s released", cidr))
+					return nil
+				})
+				if err != nil {
+					undoRestoreConflicts(ipr, restored)
+					ipr.unfree(obj.ObjectName(), cidrs)
+					ipr.object.Event(corev1.EventTypeWarning, "release", fmt.Sprintf("release update failed: %s", err))
+					return reconcile.Delay(logger, err)
+				}
+				ipr.updateState(logger)
+				ipr.object.Event(corev1.EventTypeNormal, "release", fmt.Sprintf("cidr %s released", released))
+				this.enqueueWaiting(this.rangeKey(ref))
+				if pending != len(ipr.pendingDeleted()) || ipr.isCooling() {
+					this.Controller().Enqueue(ipr.object)
 				}
 			}
 		}
 	}
+	if this.Controller().HasFinalizer(obj) {
+		if err := this.deleteOutput(logger, obj); err != nil {
+			return reconcile.Delay(logger, err)
+		}
+	}
 	return reconcile.DelayOnError(logger, this.Controller().RemoveFinalizer(obj))
 }
 
 func (this *Reconciler) deletedRequest(logger logger.LogContext, key resources.ClusterObjectKey) reconcile.Status {
 	this.CleanupUser(logger, "cleanup", this.Controller(), key, reconcilers.EnqueueAction)
+	this.dropConflicts(key)
 	return reconcile.Succeeded(logger)
 }
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	"github.com/gardener/controller-manager-library/pkg/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+)
+
+var _ = Describe("Request", func() {
+	var log logger.LogContext
+	var reconciler *Reconciler
+	var ctrl *testController
+	var ns *corev1.Namespace
+
+	BeforeEach(func() {
+		log = logger.New()
+		reconciler, ctrl = newTestReconciler()
+		ns = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: map[string]string{"network": "shared"}},
+		}
+		ctrl.addObject(NAMESPACE, ns)
+		rng := ctrl.addObject(api.IPAMRANGE, &api.IPAMRange{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "net", Name: "pool"},
+			Spec: api.IPAMRangeSpec{
+				Ranges: []string{"10.0.0.0/24"},
+				AllowedNamespaces: &api.AllowedNamespaces{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"network": "shared"}},
+				},
+			},
+		})
+		reconciler.reconcileRange(log, rng)
+		Expect(rng.Data().(*api.IPAMRange).Status.State).To(Equal(api.STATE_READY))
+	})
+
+	Context("leased request of a namespace not allowed anymore", func() {
+		var obj *testObject
+		var req *api.IPAMRequest
+
+		BeforeEach(func() {
+			req = &api.IPAMRequest{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "leased"},
+				Spec: api.IPAMRequestSpec{
+					IPAM:          api.IPAMReference{ObjectReference: types.ObjectReference{Namespace: "net", Name: "pool"}},
+					Size:          32,
+					LeaseDuration: &metav1.Duration{Duration: time.Minute},
+				},
+			}
+			obj = ctrl.addObject(api.IPAMREQUEST, req)
+			reconciler.reconcileRequest(log, obj)
+			Expect(req.Status.State).To(Equal(api.STATE_READY))
+			Expect(req.Status.CIDR).NotTo(Equal(""))
+			Expect(req.Status.LeaseExpiresAt).NotTo(BeNil())
+
+			delete(ns.Labels, "network")
+		})
+
+		It("keeps an active allocation", func() {
+			cidr := req.Status.CIDR
+			reconciler.reconcileRequest(log, obj)
+			Expect(req.Status.State).To(Equal(api.STATE_INVALID))
+			Expect(req.Status.Message).To(Equal("namespace app not allowed to use IPAMRange net/pool"))
+			Expect(req.Status.CIDR).To(Equal(cidr))
+		})
+
+		It("releases the allocation once the lease has expired", func() {
+			expired := metav1.NewTime(time.Now().Add(-time.Second))
+			req.Status.LeaseExpiresAt = &expired
+			reconciler.reconcileRequest(log, obj)
+			Expect(req.Status.State).To(Equal(api.STATE_EXPIRED))
+			Expect(req.Status.CIDR).To(Equal(""))
+			Expect(reconciler.getRange(resources.NewObjectName("net", "pool")).owners).To(BeEmpty())
+		})
+	})
+
+	Context("releasing an allocation", func() {
+		It("enqueues only waiting requests", func() {
+			ref := api.IPAMReference{ObjectReference: types.ObjectReference{Namespace: "net", Name: "pool"}}
+			leased := &api.IPAMRequest{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "leased"},
+				Spec:       api.IPAMRequestSpec{IPAM: ref, Size: 32, LeaseDuration: &metav1.Duration{Duration: time.Minute}},
+			}
+			obj := ctrl.addObject(api.IPAMREQUEST, leased)
+			reconciler.reconcileRequest(log, obj)
+			Expect(leased.Status.State).To(Equal(api.STATE_READY))
+
+			waiting := ctrl.addObject(api.IPAMREQUEST, &api.IPAMRequest{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "waiting"},
+				Spec:       api.IPAMRequestSpec{IPAM: ref, Size: 24},
+			})
+			waiting.Data().(*api.IPAMRequest).Status.State = api.STATE_BUSY
+			rangeKey := reconciler.rangeKey(resources.NewObjectName("net", "pool"))
+			reconciler.UpdateFilteredUsesFor(waiting.ClusterKey(), rangeFilter, resources.NewClusterObjectKeySet(rangeKey))
+
+			expired := metav1.NewTime(time.Now().Add(-time.Second))
+			leased.Status.LeaseExpiresAt = &expired
+			ctrl.enqueued = resources.NewClusterObjectKeySet()
+			reconciler.reconcileRequest(log, obj)
+			Expect(leased.Status.State).To(Equal(api.STATE_EXPIRED))
+			Expect(ctrl.enqueued).To(Equal(resources.NewClusterObjectKeySet(waiting.ClusterKey())))
+		})
+	})
+})
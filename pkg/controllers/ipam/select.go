@@ -0,0 +1,253 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+)
+
+// requestRange determines the object name of the range used by a request.
+// For a request choosing its range from a list or by a selector it is the
+// range recorded in the status, the name is empty as long as no range has
+// been chosen.
+func requestRange(req *api.IPAMRequest, obj resources.Object) resources.ObjectName {
+	if len(req.Spec.IPAMs) > 0 || req.Spec.IPAMSelector != nil {
+		return selectedRange(req.Status.IPAM, obj)
+	}
+	return rangeName(&req.Spec.IPAM, obj)
+}
+
+// selectedRange determines the object name of a range recorded in the
+// status of a request. Ranges of other namespaces are recorded together
+// with their namespace, ClusterIPAMRanges with an empty namespace.
+func selectedRange(name string, obj resources.Object) resources.ObjectName {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return resources.NewObjectName(name[:i], name[i+1:])
+	}
+	return resources.NewObjectName(obj.GetNamespace(), name)
+}
+
+// selectionName is the name of a chosen range recorded in the status
+// of a request.
+func selectionName(name resources.ObjectName, obj resources.Object) string {
+	if name.Namespace() == obj.GetNamespace() {
+		return name.Name()
+	}
+	return name.String()
+}
+
+// candidateNames determines the names of the ranges a request may
+// choose from. Ranges selected by labels are not considered.
+func candidateNames(req *api.IPAMRequest, obj resources.Object) []resources.ObjectName {
+	var names []resources.ObjectName
+	for i := range req.Spec.IPAMs {
+		names = append(names, rangeName(&req.Spec.IPAMs[i], obj))
+	}
+	return names
+}
+
+// selectRange chooses a range for a request and allocates the requested
+// cidrs in it. The ranges of the ipams list are tried in priority order,
+// ranges matching the ipamSelector in the order requested by ipamSelection
+// until an allocation succeeds. If no allocation is possible, the request
+// waits for space to be released in the tried ranges and the returned
+// status must be used as result of the reconciliation.
+func (this *Reconciler) selectRange(logger logger.LogContext, obj resources.Object) (*IPAM, reconcile.Status, bool) {
+	r := obj.Data().(*api.IPAMRequest)
+
+	var failed []string
+	var candidates []*IPAM
+	if len(r.Spec.IPAMs) > 0 {
+		for _, n := range candidateNames(r, obj) {
+			ipr := this.getRange(n)
+			switch {
+			case ipr == nil:
+				failed = append(failed, fmt.Sprintf("IPAMRange %s not found", n))
+			case ipr.error != "":
+				failed = append(failed, fmt.Sprintf("IPAMRange %s not valid: %s", n, ipr.error))
+			default:
+				candidates = append(candidates, ipr)
+			}
+		}
+	} else {
+		var err error
+		candidates, err = this.candidateRanges(obj.GetNamespace(), r.Spec.IPAMSelector, r.Spec.IPAMSelection)
+		if err != nil {
+			return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, err.Error())), false
+		}
+		if len(candidates) == 0 {
+			return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_BUSY, "no IPAMRange matching ipamSelector found"), 2*time.Minute), false
+		}
+	}
+	if err := this.Controller().SetFinalizer(obj); err != nil {
+		return nil, reconcile.Delay(logger, err), false
+	}
+
+	if len(r.Spec.IPAMs) == 0 {
+		// like the ranges of the ipams list all matching ranges are used
+		// until one is chosen to retry them when space is released
+		used := resources.NewClusterObjectKeySet()
+		for _, ipr := range candidates {
+			used.Add(this.rangeKey(ipr.object.ObjectName()))
+		}
+		this.UpdateFilteredUsesFor(obj.ClusterKey(), rangeFilter, used)
+	}
+
+	busy := false
+	quota := false
+	broken := false
+	for _, ipr := range candidates {
+		ipr.lock.Lock()
+		denied, invalid, err := this.checkNamespace(ipr, obj.GetNamespace())
+		if err != nil {
+			ipr.lock.Unlock()
+			return nil, reconcile.Delay(logger, err), false
+		}
+		if invalid != nil || denied != nil {
+			ipr.lock.Unlock()
+			if invalid != nil {
+				broken = true
+				failed = append(failed, invalid.Error())
+			} else {
+				failed = append(failed, denied.Error())
+			}
+			continue
+		}
+		spec, families, sizes, err := requestAllocation(r, ipr)
+		if err != nil {
+			ipr.lock.Unlock()
+			failed = append(failed, err.Error())
+			continue
+		}
+		cidrs, invalid, exhausted := ipr.allocate(spec, families, sizes, r.Spec.Count, r.Spec.Contiguous, obj.ObjectName().String())
+		if invalid != nil || exhausted != nil {
+			ipr.lock.Unlock()
+			if invalid != nil {
+				failed = append(failed, fmt.Sprintf("IPAMRange %s: %s", ipr.object.ObjectName(), invalid))
+			} else {
+				busy = true
+				failed = append(failed, fmt.Sprintf("IPAMRange %s: %s", ipr.object.ObjectName(), exhausted))
+			}
+			continue
+		}
+		exceeded, invalid, err := this.checkQuota(ipr, obj.ObjectName(), cidrs)
+		if exceeded != nil || invalid != nil || err != nil {
+			ipr.revert(cidrs)
+			ipr.lock.Unlock()
+			switch {
+			case err != nil:
+				return nil, reconcile.Delay(logger, err), false
+			case invalid != nil:
+				broken = true
+				failed = append(failed, invalid.Error())
+			default:
+				quota = true
+				failed = append(failed, exceeded.Error())
+			}
+			continue
+		}
+		if !this.Controller().HasFinalizer(ipr.object) {
+			logger.Infof("requesting finalizer for IPAM %s", ipr.object.ObjectName())
+			if err := this.Controller().SetFinalizer(ipr.object); err != nil {
+				ipr.revert(cidrs)
+				ipr.lock.Unlock()
+				return nil, reconcile.Delay(logger, err), false
+			}
+		}
+		err = this.assignCIDRs(logger, obj, ipr, cidrs, selectionName(ipr.object.ObjectName(), obj))
+		ipr.lock.Unlock()
+		if err != nil {
+			return nil, reconcile.Delay(logger, err), false
+		}
+		logger.Infof("selected IPAM %s", ipr.object.ObjectName())
+		return ipr, reconcile.Succeeded(logger), true
+	}
+	msg := strings.Join(failed, ", ")
+	if quota && !busy {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_QUOTAEXCEEDED, msg), 2*time.Minute), false
+	}
+	if broken && !busy {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_ERROR, msg)), false
+	}
+	if !busy {
+		return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_INVALID, msg)), false
+	}
+	return nil, reconcile.UpdateStatus(logger, resources.NewStandardStatusUpdate(logger, obj, api.STATE_BUSY, msg), 2*time.Minute), false
+}
+
+// candidateRanges determines the valid ranges of a namespace and the
+// ClusterIPAMRanges matching a label selector. They are ordered by name,
+// ranges of the namespace first, or, for the selection mode MostFree,
+// by the number of free addresses.
+func (this *Reconciler) candidateRanges(namespace string, selector *metav1.LabelSelector, selection string) ([]*IPAM, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ipamSelector: %s", err)
+	}
+	this.lock.RLock()
+	var candidates []*IPAM
+	for n, o := range this.ipams {
+		if n.Namespace() == namespace || n.Namespace() == "" {
+			candidates = append(candidates, o)
+		}
+	}
+	this.lock.RUnlock()
+
+	var result []*IPAM
+	free := map[*IPAM]float64{}
+	for _, o := range candidates {
+		o.lock.RLock()
+		if o.error == "" && !o.deleted && sel.Matches(labels.Set(o.object.GetLabels())) {
+			result = append(result, o)
+			free[o] = o.freeAddresses()
+		}
+		o.lock.RUnlock()
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if selection == api.SELECTION_MOSTFREE && free[result[i]] != free[result[j]] {
+			return free[result[i]] > free[result[j]]
+		}
+		if ci, cj := result[i].object.GetNamespace() == "", result[j].object.GetNamespace() == ""; ci != cj {
+			return cj
+		}
+		return result[i].object.GetName() < result[j].object.GetName()
+	})
+	return result, nil
+}
+
+// freeAddresses returns the number of addresses available for
+// allocations in all ip families of a range.
+func (this *IPAM) freeAddresses() float64 {
+	free := 0.0
+	for _, ipr := range this.ipams {
+		free += ipr.Stats().Free.Float64()
+	}
+	return free
+}
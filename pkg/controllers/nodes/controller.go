@@ -0,0 +1,85 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package nodes
+
+import (
+	"fmt"
+
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile/reconcilers"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/apis/ipam/validation"
+)
+
+const NAME = "nodes"
+
+var NODE = resources.NewGroupKind("", "Node")
+
+func init() {
+	controller.Configure(NAME).
+		ActivateExplicitly().
+		DefaultWorkerPool(2, 0).
+		OptionsByExample("options", &Config{}).
+		Reconciler(Create).
+		MainResourceByGK(NODE).
+		With(reconcilers.SlaveReconcilerForGKs("requests", controller.CLUSTER_MAIN, api.IPAMREQUEST)).
+		MustRegister()
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func Create(controller controller.Interface) (reconcile.Interface, error) {
+	cfg, err := controller.GetOptionSource("options")
+	if err != nil {
+		return nil, err
+	}
+	config := cfg.(*Config)
+
+	if config.Range == "" {
+		return nil, fmt.Errorf("range for the pod cidrs of nodes not specified")
+	}
+	ref, err := api.ParseIPAMReference(config.Range)
+	if err != nil {
+		return nil, err
+	}
+	template := &api.IPAMRequest{
+		Spec: api.IPAMRequestSpec{
+			IPAM:       *ref,
+			Request:    config.Request,
+			IPFamilies: config.IPFamilies,
+		},
+	}
+	if err := validation.ValidateIPAMRequest(template); err != nil {
+		return nil, fmt.Errorf("invalid node cidr request: %s", err)
+	}
+	requests, err := controller.GetMainCluster().Resources().Get(api.IPAMREQUEST)
+	if err != nil {
+		return nil, err
+	}
+	return &Reconciler{
+		ReconcilerSupport: reconcilers.NewReconcilerSupport(controller),
+		config:            config,
+		slaves:            reconcilers.GetSharedSimpleSlaveCache(controller),
+		requests:          requests,
+		template:          template,
+	}, nil
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package nodes
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gardener/controller-manager-library/pkg/config"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile/reconcilers"
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+)
+
+type Reconciler struct {
+	reconcilers.ReconcilerSupport
+	config   *Config
+	slaves   *reconcilers.SimpleSlaveCache
+	requests resources.Interface
+	template *api.IPAMRequest
+}
+
+var _ reconcile.Interface = &Reconciler{}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (this *Reconciler) Config() config.OptionSource {
+	return this.config
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (this *Reconciler) Reconcile(logger logger.LogContext, obj resources.Object) reconcile.Status {
+	if obj.GroupKind() != NODE {
+		return reconcile.Succeeded(logger)
+	}
+	node := obj.Data().(*corev1.Node)
+	name := this.requestName(obj)
+	req, err := this.Controller().GetCachedObject(this.NewClusterObjectKey(api.IPAMREQUEST, name))
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Delay(logger, err)
+		}
+		if node.Spec.PodCIDR != "" {
+			// pod cidrs not maintained by this controller
+			return reconcile.Succeeded(logger)
+		}
+		logger.Infof("creating IPAMRequest %s", name)
+		r := this.template.DeepCopy()
+		r.Namespace = name.Namespace()
+		r.Name = name.Name()
+		r.Spec.Description = fmt.Sprintf("pod cidrs of node %s", obj.GetName())
+		slave, err := this.requests.Wrap(r)
+		if err != nil {
+			return reconcile.Failed(logger, err)
+		}
+		if err := this.slaves.CreateSlaveFor(obj, slave); err != nil {
+			return reconcile.Delay(logger, err)
+		}
+		return reconcile.Succeeded(logger)
+	}
+	if !req.GetOwners().Contains(obj.ClusterKey()) {
+		return reconcile.Failed(logger, fmt.Errorf("IPAMRequest %s not owned by node %s", name, obj.GetName()))
+	}
+
+	r := req.Data().(*api.IPAMRequest)
+	cidrs := r.GetCIDRs()
+	if len(cidrs) == 0 {
+		if r.Status.Message != "" {
+			logger.Infof("waiting for allocation: %s: %s", r.Status.State, r.Status.Message)
+		}
+		return reconcile.Succeeded(logger)
+	}
+	if node.Spec.PodCIDR != "" {
+		if !reflect.DeepEqual(podCIDRs(node), cidrs) {
+			logger.Warnf("node uses pod cidrs %v instead of allocated %v", podCIDRs(node), cidrs)
+		}
+		return reconcile.Succeeded(logger)
+	}
+	logger.Infof("assigning pod cidrs %v", cidrs)
+	_, err = resources.Modify(obj, func(mod *resources.ModificationState) error {
+		n := mod.Data().(*corev1.Node)
+		if n.Spec.PodCIDR == "" {
+			n.Spec.PodCIDR = cidrs[0]
+			n.Spec.PodCIDRs = cidrs
+			mod.Modify(true)
+		}
+		return nil
+	})
+	if err != nil {
+		return reconcile.Delay(logger, err)
+	}
+	obj.Eventf(corev1.EventTypeNormal, "ipam", "pod cidrs %v assigned from IPAMRequest %s", cidrs, name)
+	return reconcile.Succeeded(logger)
+}
+
+func (this *Reconciler) Delete(logger logger.LogContext, obj resources.Object) reconcile.Status {
+	return reconcile.Succeeded(logger)
+}
+
+// Deleted releases the pod cidrs of a deleted node by deleting its
+// IPAMRequest.
+func (this *Reconciler) Deleted(logger logger.LogContext, key resources.ClusterObjectKey) reconcile.Status {
+	if key.GroupKind() != NODE {
+		return reconcile.Succeeded(logger)
+	}
+	for k := range this.slaves.GetSlavesFor(key, nil) {
+		req, err := this.Controller().GetCachedObject(k)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return reconcile.Delay(logger, err)
+		}
+		logger.Infof("releasing pod cidrs: deleting IPAMRequest %s", k.ObjectName())
+		if err := req.Delete(); err != nil && !errors.IsNotFound(err) {
+			return reconcile.Delay(logger, err)
+		}
+	}
+	return reconcile.Succeeded(logger)
+}
+
+// requestName is the name of the IPAMRequest of a node.
+func (this *Reconciler) requestName(node resources.Object) resources.ObjectName {
+	return resources.NewObjectName(this.config.Namespace, "node-"+node.GetName())
+}
+
+func podCIDRs(node *corev1.Node) []string {
+	if len(node.Spec.PodCIDRs) > 0 {
+		return node.Spec.PodCIDRs
+	}
+	return []string{node.Spec.PodCIDR}
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package services
+
+import (
+	"github.com/gardener/controller-manager-library/pkg/config"
+)
+
+type Config struct {
+	Range      string
+	IPFamilies []string
+}
+
+var _ config.OptionSource = &Config{}
+
+func (this *Config) AddOptionsToSet(set config.OptionSet) {
+	set.AddStringOption(&this.Range, "ipam-range", "", "", "default range for the addresses of load balancer services (<namespace>/<name> for an IPAMRange, <name> for a ClusterIPAMRange)")
+	set.AddStringArrayOption(&this.IPFamilies, "ip-families", "", nil, "default ip families to allocate load balancer addresses for")
+}
+
+func (this *Config) Prepare() error {
+	return nil
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package services
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+
+	"github.com/gardener/controller-manager-library/pkg/config"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/controller/reconcile/reconcilers"
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/apis/ipam/validation"
+)
+
+type Reconciler struct {
+	reconcilers.ReconcilerSupport
+	config       *Config
+	slaves       *reconcilers.SimpleSlaveCache
+	requests     resources.Interface
+	defaultRange *api.IPAMReference
+}
+
+var _ reconcile.Interface = &Reconciler{}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (this *Reconciler) Config() config.OptionSource {
+	return this.config
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (this *Reconciler) Reconcile(logger logger.LogContext, obj resources.Object) reconcile.Status {
+	if obj.GroupKind() != SERVICE {
+		return reconcile.Succeeded(logger)
+	}
+	svc := obj.Data().(*corev1.Service)
+	name := this.requestName(obj)
+	req, err := this.Controller().GetCachedObject(this.NewClusterObjectKey(api.IPAMREQUEST, name))
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Delay(logger, err)
+		}
+		req = nil
+	}
+	if req != nil && !req.GetOwners().Contains(obj.ClusterKey()) {
+		return reconcile.Failed(logger, fmt.Errorf("IPAMRequest %s not owned by service %s", name, obj.GetName()))
+	}
+
+	desired, err := this.request(svc)
+	if err != nil {
+		obj.Eventf(corev1.EventTypeWarning, "ipam", "%s", err)
+		return reconcile.Failed(logger, err)
+	}
+	if desired == nil {
+		if req != nil {
+			logger.Infof("no load balancer address required anymore")
+			return this.release(logger, obj, req)
+		}
+		return reconcile.Succeeded(logger)
+	}
+
+	if req == nil {
+		logger.Infof("creating IPAMRequest %s", name)
+		desired.Namespace = name.Namespace()
+		desired.Name = name.Name()
+		slave, err := this.requests.Wrap(desired)
+		if err != nil {
+			return reconcile.Failed(logger, err)
+		}
+		if err := this.slaves.CreateSlaveFor(obj, slave); err != nil {
+			return reconcile.Delay(logger, err)
+		}
+		return reconcile.Succeeded(logger)
+	}
+
+	r := req.Data().(*api.IPAMRequest)
+	if r.GetDeletionTimestamp() != nil {
+		logger.Infof("waiting for deletion of IPAMRequest %s", name)
+		return reconcile.Succeeded(logger)
+	}
+	if !reflect.DeepEqual(r.Spec.IPAM, desired.Spec.IPAM) || r.Spec.Request != desired.Spec.Request ||
+		!reflect.DeepEqual(r.Spec.IPFamilies, desired.Spec.IPFamilies) {
+		// the spec of a request cannot be changed, it has to be replaced
+		logger.Infof("requested load balancer address changed")
+		return this.release(logger, obj, req)
+	}
+
+	ips := addresses(r.GetCIDRs())
+	if len(ips) == 0 {
+		if r.Status.Message != "" {
+			logger.Infof("waiting for allocation: %s: %s", r.Status.State, r.Status.Message)
+		}
+		return reconcile.Succeeded(logger)
+	}
+	if reflect.DeepEqual(ingressIPs(svc), ips) {
+		return reconcile.Succeeded(logger)
+	}
+	logger.Infof("assigning load balancer addresses %v", ips)
+	_, err = resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+		s := mod.Data().(*corev1.Service)
+		var ingress []corev1.LoadBalancerIngress
+		for _, ip := range ips {
+			ingress = append(ingress, corev1.LoadBalancerIngress{IP: ip})
+		}
+		if !reflect.DeepEqual(s.Status.LoadBalancer.Ingress, ingress) {
+			s.Status.LoadBalancer.Ingress = ingress
+			mod.Modify(true)
+		}
+		return nil
+	})
+	if err != nil {
+		return reconcile.Delay(logger, err)
+	}
+	obj.Eventf(corev1.EventTypeNormal, "ipam", "load balancer addresses %v assigned from IPAMRequest %s", ips, name)
+	return reconcile.Succeeded(logger)
+}
+
+func (this *Reconciler) Delete(logger logger.LogContext, obj resources.Object) reconcile.Status {
+	return reconcile.Succeeded(logger)
+}
+
+// Deleted releases the address of a deleted service by deleting its
+// IPAMRequest.
+func (this *Reconciler) Deleted(logger logger.LogContext, key resources.ClusterObjectKey) reconcile.Status {
+	if key.GroupKind() != SERVICE {
+		return reconcile.Succeeded(logger)
+	}
+	for k := range this.slaves.GetSlavesFor(key, nil) {
+		req, err := this.Controller().GetCachedObject(k)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return reconcile.Delay(logger, err)
+		}
+		logger.Infof("releasing load balancer address: deleting IPAMRequest %s", k.ObjectName())
+		if err := req.Delete(); err != nil && !errors.IsNotFound(err) {
+			return reconcile.Delay(logger, err)
+		}
+	}
+	return reconcile.Succeeded(logger)
+}
+
+// release removes the addresses of a request from the load balancer status
+// of a service and deletes the request.
+func (this *Reconciler) release(logger logger.LogContext, obj resources.Object, req resources.Object) reconcile.Status {
+	ips := addresses(req.Data().(*api.IPAMRequest).GetCIDRs())
+	_, err := resources.ModifyStatus(obj, func(mod *resources.ModificationState) error {
+		s := mod.Data().(*corev1.Service)
+		var ingress []corev1.LoadBalancerIngress
+		for _, i := range s.Status.LoadBalancer.Ingress {
+			if !contains(ips, i.IP) {
+				ingress = append(ingress, i)
+			}
+		}
+		if len(ingress) != len(s.Status.LoadBalancer.Ingress) {
+			s.Status.LoadBalancer.Ingress = ingress
+			mod.Modify(true)
+		}
+		return nil
+	})
+	if err != nil {
+		return reconcile.Delay(logger, err)
+	}
+	logger.Infof("releasing load balancer address: deleting IPAMRequest %s", req.ObjectName())
+	if err := req.Delete(); err != nil && !errors.IsNotFound(err) {
+		return reconcile.Delay(logger, err)
+	}
+	return reconcile.Succeeded(logger)
+}
+
+// request determines the IPAMRequest required for a service. No request is
+// required for services of another type or if no range is configured.
+// An explicit spec.loadBalancerIP is requested as dedicated address,
+// otherwise a single address for the ip family of the service is
+// allocated.
+func (this *Reconciler) request(svc *corev1.Service) (*api.IPAMRequest, error) {
+	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return nil, nil
+	}
+	ref := this.defaultRange
+	if name := svc.GetAnnotations()[ANNOTATION_RANGE]; name != "" {
+		r, err := api.ParseIPAMReference(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %s", ANNOTATION_RANGE, err)
+		}
+		ref = r
+	}
+	if ref == nil {
+		return nil, nil
+	}
+	r := &api.IPAMRequest{
+		Spec: api.IPAMRequestSpec{
+			IPAM:        *ref,
+			Description: fmt.Sprintf("load balancer address of service %s", svc.GetName()),
+		},
+	}
+	switch {
+	case svc.Spec.LoadBalancerIP != "":
+		r.Spec.Request = svc.Spec.LoadBalancerIP
+	case svc.Spec.IPFamily != nil:
+		r.Spec.Request = "%0"
+		r.Spec.IPFamilies = []string{string(*svc.Spec.IPFamily)}
+	default:
+		r.Spec.Request = "%0"
+		r.Spec.IPFamilies = this.config.IPFamilies
+	}
+	if err := validation.ValidateIPAMRequest(r); err != nil {
+		return nil, fmt.Errorf("invalid load balancer address request: %s", err)
+	}
+	return r, nil
+}
+
+// requestName is the name of the IPAMRequest of a service.
+func (this *Reconciler) requestName(svc resources.Object) resources.ObjectName {
+	return resources.NewObjectName(svc.GetNamespace(), "service-"+svc.GetName())
+}
+
+func addresses(cidrs []string) []string {
+	var ips []string
+	for _, c := range cidrs {
+		ip, _, err := net.ParseCIDR(c)
+		if err == nil {
+			ips = append(ips, ip.String())
+		}
+	}
+	return ips
+}
+
+func ingressIPs(svc *corev1.Service) []string {
+	var ips []string
+	for _, i := range svc.Status.LoadBalancer.Ingress {
+		ips = append(ips, i.IP)
+	}
+	return ips
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -81,7 +81,9 @@ type Block struct {
 	next *Block
 }
 
-func (this *Block) canAlloc(next net.IP, reqsize int) bool {
+// canAlloc checks whether the block can host an allocation with the
+// given netmask size. Addresses set in avoid are not used.
+func (this *Block) canAlloc(next net.IP, reqsize int, avoid Bitmap) bool {
 	s, l := this.cidr.Mask.Size()
 	if s > reqsize {
 		return false
@@ -96,7 +98,7 @@ func (this *Block) canAlloc(next net.IP, reqsize int) bool {
 		if next != nil {
 			start = int(IPDiff(next, this.cidr.IP).Int64())
 		}
-		f := this.busy.canAllocate2(start, n)
+		f := (this.busy | avoid).canAllocate2(start, n)
 		return f >= 0 && f < 1<<(l-s)
 	}
 	return this.busy == 0
@@ -176,7 +178,7 @@ func (this *Block) set(cidr *net.IPNet, busy bool) bool {
 	return true
 }
 
-func (this *Block) alloc(next net.IP, reqsize int) *net.IPNet {
+func (this *Block) alloc(next net.IP, reqsize int, avoid Bitmap) *net.IPNet {
 	s, l := this.cidr.Mask.Size()
 	if s > reqsize {
 		return nil
@@ -188,7 +190,11 @@ func (this *Block) alloc(next net.IP, reqsize int) *net.IPNet {
 		if next != nil {
 			start = int(IPDiff(next, this.cidr.IP).Int64())
 		}
-		ip := this.busy.allocate2(start, n)
+		ip := (this.busy | avoid).canAllocate2(start, n)
+		if ip < 0 {
+			return nil
+		}
+		this.busy |= bitmapHostMask(n) << ip
 
 		c := &net.IPNet{
 			IP:   CIDRSubIP(this.cidr, int64(ip)),
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ParseBoundary parses the netmask size of the boundary blocks
+// given as <netmasksize> or /<netmasksize>.
+func ParseBoundary(s string) (int, error) {
+	size, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(s), "/"), 10, 32)
+	if err != nil || size <= 0 || size > net.IPv6len*8-2 {
+		return 0, fmt.Errorf("invalid boundary %q: use /<netmasksize>", s)
+	}
+	return int(size), nil
+}
+
+// SetAvoidBoundaryAddresses configures the IPAM to skip the first and
+// last address of every aligned block with the given netmask size when
+// allocating single addresses. A size of 0 disables the policy.
+// Explicitly requested addresses are not affected.
+func (this *IPAM) SetAvoidBoundaryAddresses(size int) error {
+	if size < 0 || size > this.Bits()-2 {
+		return fmt.Errorf("boundary size %d invalid for %d bit network", size, this.Bits())
+	}
+	this.boundary = size
+	return nil
+}
+
+func (this *IPAM) AvoidBoundaryAddresses() int {
+	return this.boundary
+}
+
+// avoidsBoundary checks whether boundary addresses must be
+// avoided for an allocation with the given netmask size.
+func (this *IPAM) avoidsBoundary(reqsize int) bool {
+	return this.boundary > 0 && reqsize == this.Bits()
+}
+
+// avoidMask returns the bitmap of the addresses of a block, which must
+// not be used for an allocation with the given netmask size.
+func (this *IPAM) avoidMask(b *Block, reqsize int) Bitmap {
+	if !this.avoidsBoundary(reqsize) {
+		return 0
+	}
+	return b.boundaryMask(this.boundary)
+}
+
+// boundaryMask returns the bitmap of the first and last addresses of all
+// aligned blocks with the given netmask size inside a bitmap block.
+func (this *Block) boundaryMask(boundary int) Bitmap {
+	s, l := this.cidr.Mask.Size()
+	hostsize := l - s
+	if hostsize > MAX_BITMAP_NET {
+		return 0
+	}
+	var mask Bitmap
+	if h := l - boundary; h <= hostsize {
+		for i := 0; i < 1<<hostsize; i += 1 << h {
+			mask |= 1<<i | 1<<(i+1<<h-1)
+		}
+		return mask
+	}
+	outer := boundaryBlock(this.cidr.IP, boundary)
+	if outer.IP.Equal(this.cidr.IP) {
+		mask |= 1
+	}
+	if CIDRLastIP(outer).Equal(CIDRLastIP(this.cidr)) {
+		mask |= 1 << (1<<hostsize - 1)
+	}
+	return mask
+}
+
+// avoidBoundary adjusts a single address selected by a strategy inside
+// a free block, if it is the first or last address of a boundary block.
+// The neighbour inside the boundary block is used instead, which is
+// part of the same free block, because free blocks consisting of a
+// single boundary address are never offered to a strategy.
+func (this *IPAM) avoidBoundary(cidr *net.IPNet) *net.IPNet {
+	outer := boundaryBlock(cidr.IP, this.boundary)
+	switch {
+	case outer.IP.Equal(cidr.IP):
+		return &net.IPNet{IP: IPAdd(cidr.IP, 1), Mask: cidr.Mask}
+	case CIDRLastIP(outer).Equal(cidr.IP):
+		return &net.IPNet{IP: IPAdd(cidr.IP, -1), Mask: cidr.Mask}
+	}
+	return cidr
+}
+
+// isBoundary checks whether a single address cidr is the first or last
+// address of a boundary block.
+func (this *IPAM) isBoundary(cidr *net.IPNet) bool {
+	outer := boundaryBlock(cidr.IP, this.boundary)
+	return outer.IP.Equal(cidr.IP) || CIDRLastIP(outer).Equal(cidr.IP)
+}
+
+// withoutBoundaries calls a function for the areas of a free cidr
+// without the boundary addresses in address order, until it returns true.
+func (this *IPAM) withoutBoundaries(cidr *net.IPNet, f func(first, last net.IP) bool) bool {
+	last := CIDRLastIP(cidr)
+	ip := cidr.IP
+	for {
+		outer := boundaryBlock(ip, this.boundary)
+		end := CIDRLastIP(outer)
+		first, stop := ip, end
+		if IPCmp(last, end) < 0 {
+			stop = last
+		}
+		if first.Equal(outer.IP) {
+			first = IPAdd(first, 1)
+		}
+		if stop.Equal(end) {
+			stop = IPAdd(stop, -1)
+		}
+		if IPCmp(first, stop) <= 0 && f(first, stop) {
+			return true
+		}
+		if IPCmp(end, last) >= 0 {
+			return false
+		}
+		ip = IPAdd(end, 1)
+	}
+}
+
+// boundaryBlock returns the aligned block with the given netmask
+// size containing an ip.
+func boundaryBlock(ip net.IP, boundary int) *net.IPNet {
+	mask := net.CIDRMask(boundary, len(ip)*8)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
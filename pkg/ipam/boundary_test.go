@@ -0,0 +1,93 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Boundary Addresses", func() {
+	var ipam *IPAM
+
+	BeforeEach(func() {
+		ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/22"))
+		Expect(ipam.SetAvoidBoundaryAddresses(24)).To(BeNil())
+	})
+
+	It("parses boundaries", func() {
+		Expect(ParseBoundary("/24")).To(Equal(24))
+		Expect(ParseBoundary("24")).To(Equal(24))
+		_, err := ParseBoundary("/0")
+		Expect(err).To(Equal(fmt.Errorf("invalid boundary \"/0\": use /<netmasksize>")))
+		_, err = ParseBoundary("/127")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects boundaries too small for the network", func() {
+		Expect(ipam.SetAvoidBoundaryAddresses(31)).To(Equal(fmt.Errorf("boundary size 31 invalid for 32 bit network")))
+		Expect(ipam.AvoidBoundaryAddresses()).To(Equal(24))
+	})
+
+	It("skips the first address", func() {
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.1/32"))
+	})
+
+	It("skips boundary addresses of all blocks", func() {
+		for i := 1; i < 255; i++ {
+			Expect(ipam.Alloc(32).String()).To(Equal(fmt.Sprintf("10.0.0.%d/32", i)))
+		}
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.1.1/32"))
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.255/32"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.0/32"))).To(BeTrue())
+	})
+
+	It("handles boundaries smaller than a bitmap block", func() {
+		Expect(ipam.SetAvoidBoundaryAddresses(30)).To(BeNil())
+		var list []string
+		for i := 0; i < 4; i++ {
+			list = append(list, ipam.Alloc(32).String())
+		}
+		Expect(list).To(Equal([]string{"10.0.0.1/32", "10.0.0.2/32", "10.0.0.5/32", "10.0.0.6/32"}))
+	})
+
+	It("does not affect larger allocations", func() {
+		Expect(ipam.Alloc(30).String()).To(Equal("10.0.0.0/30"))
+	})
+
+	It("is used by strategies", func() {
+		ipam.SetStrategy(LastMatch)
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.3.254/32"))
+		Expect(ipam.Free(MustParseCIDR("10.0.3.254/32"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.3.254/32"))).To(BeTrue())
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.3.253/32"))
+	})
+
+	It("never allocates a single free boundary address", func() {
+		ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/30"))
+		Expect(ipam.SetAvoidBoundaryAddresses(30)).To(BeNil())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.1/32"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.2/32"))).To(BeTrue())
+		Expect(ipam.Alloc(32)).To(BeNil())
+		ipam.SetStrategy(BestFit)
+		Expect(ipam.Alloc(32)).To(BeNil())
+	})
+})
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+// CoolingCIDR is a released cidr, which cannot be allocated
+// again before the end of the release cooldown.
+type CoolingCIDR struct {
+	CIDR  *net.IPNet
+	Until time.Time
+}
+
+// SetReleaseCooldown sets the time released cidrs are kept busy before
+// they can be allocated again. Cidrs already cooling keep their time.
+func (this *IPAM) SetReleaseCooldown(d time.Duration) {
+	this.cooldown = d
+}
+
+func (this *IPAM) ReleaseCooldown() time.Duration {
+	return this.cooldown
+}
+
+// Cooling returns the cidrs still cooling ordered by the end of
+// their cooldown.
+func (this *IPAM) Cooling() []CoolingCIDR {
+	return append([]CoolingCIDR(nil), this.cooling...)
+}
+
+// CoolingSize returns the number of cooling addresses.
+func (this *IPAM) CoolingSize() Int {
+	size := IntZero
+	for _, c := range this.cooling {
+		size = size.Add(CIDRHostSize(c.CIDR))
+	}
+	return size
+}
+
+// NextCoolingExpiry returns the end of the next cooldown.
+func (this *IPAM) NextCoolingExpiry() (time.Time, bool) {
+	if len(this.cooling) == 0 {
+		return time.Time{}, false
+	}
+	return this.cooling[0].Until, true
+}
+
+// Cool marks a free cidr as busy until the given time. It is used
+// to restore the cooling state.
+func (this *IPAM) Cool(cidr *net.IPNet, until time.Time) bool {
+	cidr = CIDRAlign(cidr, this.Bits())
+	if cidr == nil || !this.set(cidr, true) {
+		return false
+	}
+	this.addCooling(cidr, until)
+	return true
+}
+
+// ExpireCooling frees all cidrs with an expired cooldown and
+// returns them.
+func (this *IPAM) ExpireCooling() CIDRList {
+	var freed CIDRList
+	now := this.now()
+	for len(this.cooling) > 0 && !this.cooling[0].Until.After(now) {
+		c := this.cooling[0].CIDR
+		this.cooling = this.cooling[1:]
+		if this.set(c, false) {
+			freed = append(freed, c)
+			if len(this.reservePending) > 0 {
+				this.reserveFreed(c)
+			}
+		}
+	}
+	if len(this.cooling) == 0 {
+		this.cooling = nil
+	}
+	return freed
+}
+
+// release frees a busy cidr, which is not cooling. With a release
+// cooldown it is kept busy and cooling instead. Cidrs in ranges pending for deletion
+// are deleted directly.
+func (this *IPAM) release(cidr *net.IPNet) bool {
+	for _, c := range this.cooling {
+		if CIDRContains(c.CIDR, cidr) {
+			return false
+		}
+	}
+	if !this.set(cidr, false) {
+		return false
+	}
+	if this.cooldown > 0 {
+		this.dropCooling(cidr)
+		if this.set(cidr, true) {
+			this.addCooling(cidr, this.now().Add(this.cooldown))
+			return true
+		}
+	}
+	if len(this.reservePending) > 0 {
+		this.reserveFreed(cidr)
+	}
+	return true
+}
+
+// CancelCooling cancels the pending cooldown of a released cidr. The cidr
+// is kept busy. It is used to undo a release, whose cidr is still in use.
+func (this *IPAM) CancelCooling(cidr *net.IPNet) bool {
+	cidr = CIDRAlign(cidr, this.Bits())
+	if cidr == nil {
+		return false
+	}
+	for i, c := range this.cooling {
+		if CIDREqual(c.CIDR, cidr) {
+			this.cooling = append(this.cooling[:i], this.cooling[i+1:]...)
+			if len(this.cooling) == 0 {
+				this.cooling = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (this *IPAM) addCooling(cidr *net.IPNet, until time.Time) {
+	this.cooling = append(this.cooling, CoolingCIDR{CIDR: cidr, Until: until})
+	sort.SliceStable(this.cooling, func(i, j int) bool {
+		return this.cooling[i].Until.Before(this.cooling[j].Until)
+	})
+}
+
+// dropCooling removes cooling cidrs freed as part of a larger cidr.
+func (this *IPAM) dropCooling(cidr *net.IPNet) {
+	i := 0
+	for i < len(this.cooling) {
+		if CIDRContains(cidr, this.cooling[i].CIDR) {
+			this.cooling = append(this.cooling[:i], this.cooling[i+1:]...)
+		} else {
+			i++
+		}
+	}
+}
+
+func (this *IPAM) now() time.Time {
+	if this.clock != nil {
+		return this.clock()
+	}
+	return time.Now()
+}
+
+// Revert frees a cidr ignoring the release cooldown. It is used to
+// revert an allocation, which has never been handed out.
+func (this *IPAM) Revert(cidr *net.IPNet) bool {
+	cidr = CIDRAlign(cidr, this.Bits())
+	if cidr == nil {
+		this.observe(OP_FREE, false)
+		return false
+	}
+	ok := this.set(cidr, false)
+	if ok && len(this.reservePending) > 0 {
+		this.reserveFreed(cidr)
+	}
+	this.observe(OP_FREE, ok)
+	return ok
+}
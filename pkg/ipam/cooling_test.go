@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cooling", func() {
+	var ipam *IPAM
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+		ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/30"))
+		ipam.clock = func() time.Time { return now }
+		ipam.SetReleaseCooldown(time.Minute)
+	})
+
+	It("keeps released cidrs busy", func() {
+		c := ipam.Alloc(32)
+		Expect(c.String()).To(Equal("10.0.0.0/32"))
+		Expect(ipam.Free(c)).To(BeTrue())
+		Expect(ipam.Free(c)).To(BeFalse())
+		Expect(ipam.Cooling()).To(Equal([]CoolingCIDR{{c, now.Add(time.Minute)}}))
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.1/32"))
+		Expect(ipam.Busy(c)).To(BeFalse())
+	})
+
+	It("releases cidrs after the cooldown", func() {
+		c := ipam.Alloc(32)
+		ipam.Free(c)
+		now = now.Add(30 * time.Second)
+		d := ipam.Alloc(32)
+		ipam.Free(d)
+		until, ok := ipam.NextCoolingExpiry()
+		Expect(ok).To(BeTrue())
+		Expect(until).To(Equal(now.Add(30 * time.Second)))
+
+		now = now.Add(30 * time.Second)
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.0/32"))
+		Expect(ipam.Cooling()).To(Equal([]CoolingCIDR{{d, now.Add(30 * time.Second)}}))
+	})
+
+	It("restores cooling cidrs", func() {
+		c := MustParseCIDR("10.0.0.2/32")
+		Expect(ipam.Cool(c, now.Add(time.Minute))).To(BeTrue())
+		Expect(ipam.Cool(c, now.Add(time.Minute))).To(BeFalse())
+		Expect(ipam.Busy(c)).To(BeFalse())
+		now = now.Add(time.Minute)
+		Expect(ipam.ExpireCooling()).To(Equal(CIDRList{c}))
+		Expect(ipam.Busy(c)).To(BeTrue())
+	})
+
+	It("reports cooling addresses separately", func() {
+		ipam.Free(ipam.Alloc(31))
+		ipam.Alloc(32)
+		stats := ipam.Stats()
+		Expect(stats.Used).To(Equal(Int64(1)))
+		Expect(stats.Cooling).To(Equal(Int64(2)))
+		Expect(stats.Free).To(Equal(Int64(1)))
+	})
+
+	It("deletes cidrs of deleted ranges directly", func() {
+		c := ipam.Alloc(32)
+		ipam.DeleteCIDRs(CIDRList{MustParseCIDR("10.0.0.0/30")})
+		Expect(ipam.Free(c)).To(BeTrue())
+		Expect(ipam.Cooling()).To(BeEmpty())
+		Expect(ipam.PendingDeleted()).To(BeNil())
+	})
+
+	It("reserves cidrs after the cooldown", func() {
+		c := ipam.Alloc(32)
+		ipam.SetReserved(CIDRList{c})
+		ipam.Free(c)
+		Expect(ipam.Reserved()).To(BeNil())
+		now = now.Add(time.Minute)
+		ipam.ExpireCooling()
+		list := ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.0.0/32]"))
+	})
+
+	It("cancels the cooldown of an undone release", func() {
+		c := ipam.Alloc(32)
+		Expect(ipam.Free(c)).To(BeTrue())
+		Expect(ipam.CancelCooling(c)).To(BeTrue())
+		Expect(ipam.CancelCooling(c)).To(BeFalse())
+		Expect(ipam.Cooling()).To(BeEmpty())
+		Expect(ipam.Busy(c)).To(BeFalse())
+		now = now.Add(time.Minute)
+		Expect(ipam.ExpireCooling()).To(BeNil())
+		Expect(ipam.Busy(c)).To(BeFalse())
+		Expect(ipam.Free(c)).To(BeTrue())
+	})
+
+	It("reverts allocations without cooldown", func() {
+		c := ipam.Alloc(32)
+		Expect(ipam.Revert(c)).To(BeTrue())
+		Expect(ipam.Cooling()).To(BeEmpty())
+		Expect(ipam.Alloc(32)).To(Equal(c))
+	})
+})
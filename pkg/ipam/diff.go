@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"net"
+)
+
+// BusyCIDRs returns the maximal busy blocks of the IPAM.
+func (this *IPAM) BusyCIDRs() CIDRList {
+	var list CIDRList
+	for b := this.block; b != nil; b = b.next {
+		list = append(list, b.cidrs(b.cidr, true)...)
+	}
+	return list
+}
+
+// Diff compares the allocations of two IPAMs. It returns the busy
+// blocks of this IPAM, which are free in the other one, and the busy
+// blocks of the other IPAM, which are free in this one.
+// Addresses not managed by an IPAM are ignored.
+func (this *IPAM) Diff(other *IPAM) (CIDRList, CIDRList) {
+	return this.busyFreeIn(other), other.busyFreeIn(this)
+}
+
+func (this *IPAM) busyFreeIn(other *IPAM) CIDRList {
+	var list CIDRList
+	for _, c := range this.BusyCIDRs() {
+		list = append(list, other.freeIn(c)...)
+	}
+	return list
+}
+
+// freeIn returns the maximal free blocks of the IPAM inside the given cidr.
+func (this *IPAM) freeIn(cidr *net.IPNet) CIDRList {
+	var list CIDRList
+	for b := this.block; b != nil; b = b.next {
+		switch {
+		case CIDRContains(cidr, b.cidr):
+			list = append(list, b.cidrs(b.cidr, false)...)
+		case CIDRContains(b.cidr, cidr):
+			list = append(list, b.cidrs(cidr, false)...)
+		}
+	}
+	return list
+}
+
+// cidrs returns the maximal blocks with the given busy state
+// inside the given cidr, which must be part of the block.
+func (this *Block) cidrs(cidr *net.IPNet, busy bool) CIDRList {
+	if this.HostSize() > MAX_BITMAP_NET {
+		if this.isBusy() == busy {
+			return CIDRList{cidr}
+		}
+		return nil
+	}
+	var list CIDRList
+	start := int(IPDiff(cidr.IP, this.cidr.IP).Int64())
+	bitmapCIDRs(&list, this.cidr, this.busy, start, CIDRHostMaskSize(cidr), busy)
+	return list
+}
+
+// bitmapCIDRs adds the maximal buddy blocks with the given busy state
+// of the bitmap area of the given host size starting at start.
+func bitmapCIDRs(list *CIDRList, base *net.IPNet, bitmap Bitmap, start, hostsize int, busy bool) {
+	m := hostmask[hostsize] << start
+	if state := bitmap & m; (busy && state == m) || (!busy && state == 0) {
+		_, l := base.Mask.Size()
+		*list = append(*list, &net.IPNet{
+			IP:   CIDRSubIP(base, int64(start)),
+			Mask: net.CIDRMask(l-hostsize, l),
+		})
+		return
+	}
+	if hostsize > 0 {
+		bitmapCIDRs(list, base, bitmap, start, hostsize-1, busy)
+		bitmapCIDRs(list, base, bitmap, start+(1<<(hostsize-1)), hostsize-1, busy)
+	}
+}
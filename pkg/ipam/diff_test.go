@@ -0,0 +1,73 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func cidrs(list CIDRList) string {
+	return list.String()
+}
+
+var _ = Describe("Diff", func() {
+	var a, b *IPAM
+
+	BeforeEach(func() {
+		ranges := MustParseIPRanges("10.0.0.0/16")
+		a, _ = NewIPAMForRanges(ranges)
+		b, _ = NewIPAMForRanges(ranges)
+	})
+
+	It("reports busy blocks", func() {
+		a.Busy(MustParseCIDR("10.0.1.0/24"))
+		a.Busy(MustParseCIDR("10.0.2.4/30"))
+		a.Busy(MustParseCIDR("10.0.2.9/32"))
+		Expect(cidrs(a.BusyCIDRs())).To(Equal("[10.0.1.0/24,10.0.2.4/30,10.0.2.9/32]"))
+	})
+
+	It("reports no differences", func() {
+		a.Busy(MustParseCIDR("10.0.1.0/24"))
+		b.Busy(MustParseCIDR("10.0.1.0/24"))
+		onlyA, onlyB := a.Diff(b)
+		Expect(onlyA).To(BeNil())
+		Expect(onlyB).To(BeNil())
+	})
+
+	It("reports differences", func() {
+		a.Busy(MustParseCIDR("10.0.1.0/24"))
+		a.Busy(MustParseCIDR("10.0.2.0/30"))
+		b.Busy(MustParseCIDR("10.0.1.0/25"))
+		b.Busy(MustParseCIDR("10.0.2.0/31"))
+		b.Busy(MustParseCIDR("10.0.3.0/26"))
+		onlyA, onlyB := a.Diff(b)
+		Expect(cidrs(onlyA)).To(Equal("[10.0.1.128/25,10.0.2.2/31]"))
+		Expect(cidrs(onlyB)).To(Equal("[10.0.3.0/26]"))
+	})
+
+	It("reports differences of large blocks", func() {
+		a.Busy(MustParseCIDR("10.0.0.0/17"))
+		b.Busy(MustParseCIDR("10.0.0.0/18"))
+		b.Busy(MustParseCIDR("10.0.128.5/32"))
+		onlyA, onlyB := a.Diff(b)
+		Expect(cidrs(onlyA)).To(Equal("[10.0.64.0/18]"))
+		Expect(cidrs(onlyB)).To(Equal("[10.0.128.5/32]"))
+	})
+})
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+)
+
+// IP families handled by an IPAM. An IPAM always manages
+// addresses of a single family.
+const IPv4 = "IPv4"
+const IPv6 = "IPv6"
+
+func IPFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return IPv4
+	}
+	return IPv6
+}
+
+func CIDRFamily(cidr *net.IPNet) string {
+	if len(cidr.Mask) == net.IPv4len {
+		return IPv4
+	}
+	return IPFamily(cidr.IP)
+}
+
+// FamilyBits returns the number of address bits for an IP family
+// or 0 for an unknown family.
+func FamilyBits(family string) int {
+	switch family {
+	case IPv4:
+		return net.IPv4len * 8
+	case IPv6:
+		return net.IPv6len * 8
+	}
+	return 0
+}
+
+// BitsFamily returns the IP family for a number of address bits.
+func BitsFamily(bits int) string {
+	switch bits {
+	case net.IPv4len * 8:
+		return IPv4
+	case net.IPv6len * 8:
+		return IPv6
+	}
+	return ""
+}
+
+func ValidateFamily(family string) error {
+	if FamilyBits(family) == 0 {
+		return fmt.Errorf("invalid ip family %q: use %s or %s", family, IPv4, IPv6)
+	}
+	return nil
+}
+
+// Families returns the IP families used by the ranges in the
+// order of their first occurrence.
+func (this IPRanges) Families() []string {
+	var families []string
+	for _, r := range this {
+		f := IPFamily(r.Start)
+		if len(families) == 0 || (len(families) == 1 && families[0] != f) {
+			families = append(families, f)
+		}
+	}
+	return families
+}
+
+// ForFamily returns the ranges of the given IP family.
+func (this IPRanges) ForFamily(family string) IPRanges {
+	result := IPRanges{}
+	for _, r := range this {
+		if IPFamily(r.Start) == family {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// ForFamily returns the cidrs of the given IP family.
+func (this CIDRList) ForFamily(family string) CIDRList {
+	result := CIDRList{}
+	for _, c := range this {
+		if CIDRFamily(c) == family {
+			result = append(result, c)
+		}
+	}
+	return result
+}
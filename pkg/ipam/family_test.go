@@ -0,0 +1,55 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Family", func() {
+
+	ranges := MustParseIPRanges("fd00::/120", "10.0.0.0/24", "10.1.0.0-10.1.0.10", "fd01::1")
+
+	It("determines families in order", func() {
+		Expect(ranges.Families()).To(Equal([]string{IPv6, IPv4}))
+		Expect(ranges[1:].Families()).To(Equal([]string{IPv4, IPv6}))
+		Expect(ranges[1:3].Families()).To(Equal([]string{IPv4}))
+		Expect(IPRanges{}.Families()).To(BeNil())
+	})
+
+	It("filters ranges", func() {
+		Expect(ranges.ForFamily(IPv4)).To(Equal(MustParseIPRanges("10.0.0.0/24", "10.1.0.0-10.1.0.10")))
+		Expect(ranges.ForFamily(IPv6)).To(Equal(MustParseIPRanges("fd00::/120", "fd01::1")))
+	})
+
+	It("filters cidrs", func() {
+		list := CIDRList{MustParseCIDR("10.0.0.0/24"), MustParseCIDR("fd00::/120")}
+		Expect(list.ForFamily(IPv4)).To(Equal(CIDRList{MustParseCIDR("10.0.0.0/24")}))
+		Expect(list.ForFamily(IPv6)).To(Equal(CIDRList{MustParseCIDR("fd00::/120")}))
+	})
+
+	It("maps bits", func() {
+		Expect(FamilyBits(IPv4)).To(Equal(32))
+		Expect(FamilyBits(IPv6)).To(Equal(128))
+		Expect(BitsFamily(32)).To(Equal(IPv4))
+		Expect(BitsFamily(128)).To(Equal(IPv6))
+		Expect(ValidateFamily("IPv5")).NotTo(Succeed())
+	})
+})
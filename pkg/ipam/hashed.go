@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"hash/fnv"
+	"net"
+)
+
+// HashedCIDR returns the preferred cidr with the given netmask size
+// for a key. The key is hashed (FNV-1a) and the hash modulo the number
+// of possible cidrs selects the cidr counting through the given ranges
+// in order. Ranges too small for the netmask size are ignored.
+// The result is predictable and independent of the allocation state,
+// it is nil if no range can host the netmask size.
+func HashedCIDR(ranges CIDRList, key string, reqsize int) *net.IPNet {
+	total := IntZero
+	for _, r := range ranges {
+		if CIDRNetMaskSize(r) <= reqsize && reqsize <= CIDRBits(r) {
+			total = total.Add(subCIDRCount(r, reqsize))
+		}
+	}
+	if total.Sgn() == 0 {
+		return nil
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	n := Uint64(h.Sum64()).Mod(total)
+	for _, r := range ranges {
+		if CIDRNetMaskSize(r) <= reqsize && reqsize <= CIDRBits(r) {
+			c := subCIDRCount(r, reqsize)
+			if n.Cmp(c) < 0 {
+				return CIDRAlign(subCIDR(r, reqsize, n), CIDRBits(r))
+			}
+			n = n.Sub(c)
+		}
+	}
+	return nil
+}
+
+// SetHashed enables the hashed mode. Allocations done for a key
+// prefer the cidr determined by HashedCIDR and fall back to the next
+// free cidr in address order.
+func (this *IPAM) SetHashed(b bool) {
+	this.hashed = b
+}
+
+func (this *IPAM) IsHashed() bool {
+	return this.hashed
+}
+
+// AllocFor allocates a cidr with the given netmask size for a key.
+// Without hashed mode the key is ignored.
+func (this *IPAM) AllocFor(key string, reqsize int) *net.IPNet {
+	cidr := this.alloc(reqsize, key)
+	this.observe(OP_ALLOC, cidr != nil)
+	return cidr
+}
+
+// AllocSpec allocates a cidr according to a request spec for a key.
+// Without hashed mode the key is ignored.
+func (this *IPAM) AllocSpec(spec RequestSpec, key string) (*net.IPNet, error) {
+	if s, ok := spec.(keyedRequestSpec); ok {
+		return s.allocFor(this, key)
+	}
+	return spec.Alloc(this)
+}
+
+// allocHashed tries the preferred cidr for the key and probes linearly
+// through the free space starting at the preferred cidr if it is
+// already in use.
+func (this *IPAM) allocHashed(key string, reqsize int) *net.IPNet {
+	preferred := HashedCIDR(this.ranges, key, reqsize)
+	if preferred == nil {
+		return nil
+	}
+	avoid := this.avoidsBoundary(reqsize)
+	if !(avoid && this.isBoundary(preferred)) && this.set(preferred, true) {
+		return preferred
+	}
+
+	free := this.freeCIDRs(reqsize)
+	if len(free) == 0 {
+		return nil
+	}
+	start := len(free)
+	for i, c := range free {
+		if IPCmp(CIDRLastIP(c), preferred.IP) >= 0 {
+			start = i
+			break
+		}
+	}
+	// the block containing the preferred cidr is visited twice to cover
+	// the part before the preferred cidr after wrapping around
+	for i := 0; i <= len(free); i++ {
+		c := free[(start+i)%len(free)]
+		cidr := subCIDR(c, reqsize, IntZero)
+		if i == 0 && c.Contains(preferred.IP) {
+			cidr = preferred
+		}
+		cidr = CIDRAlign(cidr, this.Bits())
+		for avoid && this.isBoundary(cidr) {
+			cidr = &net.IPNet{IP: IPAdd(cidr.IP, 1), Mask: cidr.Mask}
+		}
+		if c.Contains(cidr.IP) && this.set(cidr, true) {
+			return cidr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hashed", func() {
+	var ipam *IPAM
+	ranges := MustParseIPRanges("10.0.0.0/28")
+
+	BeforeEach(func() {
+		ipam, _ = NewIPAMForRanges(ranges)
+		ipam.SetHashed(true)
+	})
+
+	It("is predictable", func() {
+		list := CIDRList{MustParseCIDR("10.0.0.0/28")}
+		Expect(HashedCIDR(list, "default/f", 32).String()).To(Equal("10.0.0.15/32"))
+		Expect(HashedCIDR(list, "default/g", 32).String()).To(Equal("10.0.0.12/32"))
+		Expect(HashedCIDR(list, "default/g", 30).String()).To(Equal("10.0.0.0/30"))
+		Expect(HashedCIDR(list, "default/g", 27)).To(BeNil())
+	})
+
+	It("counts through multiple ranges", func() {
+		list := CIDRList{MustParseCIDR("10.0.0.0/30"), MustParseCIDR("10.1.0.0/30")}
+		Expect(HashedCIDR(list, "default/a", 32).String()).To(Equal("10.1.0.2/32"))
+	})
+
+	It("allocates the preferred cidr", func() {
+		Expect(ipam.AllocFor("default/g", 32).String()).To(Equal("10.0.0.12/32"))
+		Expect(ipam.AllocFor("default/f", 32).String()).To(Equal("10.0.0.15/32"))
+	})
+
+	It("probes linearly", func() {
+		Expect(ipam.AllocFor("default/g", 32).String()).To(Equal("10.0.0.12/32"))
+		Expect(ipam.AllocFor("default/g", 32).String()).To(Equal("10.0.0.13/32"))
+		Expect(ipam.AllocFor("default/g", 32).String()).To(Equal("10.0.0.14/32"))
+	})
+
+	It("wraps around", func() {
+		Expect(ipam.AllocFor("default/f", 32).String()).To(Equal("10.0.0.15/32"))
+		Expect(ipam.AllocFor("default/f", 32).String()).To(Equal("10.0.0.0/32"))
+	})
+
+	It("uses the space before the preferred cidr", func() {
+		for i := 0; i < 15; i++ {
+			Expect(ipam.AllocFor("default/g", 32)).NotTo(BeNil())
+		}
+		Expect(ipam.AllocFor("default/f", 32).String()).To(Equal("10.0.0.11/32"))
+		Expect(ipam.AllocFor("default/f", 32)).To(BeNil())
+	})
+
+	It("skips boundary addresses", func() {
+		Expect(ipam.SetAvoidBoundaryAddresses(28)).To(BeNil())
+		Expect(ipam.AllocFor("default/f", 32).String()).To(Equal("10.0.0.1/32"))
+	})
+
+	It("allocates by request spec", func() {
+		spec, _ := ParseRequestSpec("30")
+		cidr, err := ipam.AllocSpec(spec, "default/g")
+		Expect(err).To(BeNil())
+		Expect(cidr.String()).To(Equal("10.0.0.0/30"))
+		cidr, err = ipam.AllocSpec(spec, "default/g")
+		Expect(err).To(BeNil())
+		Expect(cidr.String()).To(Equal("10.0.0.4/30"))
+	})
+
+	It("ignores the mode without key", func() {
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.0/32"))
+	})
+
+	It("uses the key for host mask and amount specs", func() {
+		spec, _ := ParseRequestSpec("%0")
+		cidr, err := ipam.AllocSpec(spec, "default/g")
+		Expect(err).To(BeNil())
+		Expect(cidr.String()).To(Equal("10.0.0.12/32"))
+		spec, _ = ParseRequestSpec("#1")
+		cidr, err = ipam.AllocSpec(spec, "default/f")
+		Expect(err).To(BeNil())
+		Expect(cidr.String()).To(Equal("10.0.0.15/32"))
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.0/32"))
+	})
+})
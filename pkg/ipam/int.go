@@ -42,6 +42,10 @@ func Int64(i int64) Int {
 	return Int(*big.NewInt(i))
 }
 
+func Uint64(u uint64) Int {
+	return Int(*new(big.Int).SetUint64(u))
+}
+
 func (this Int) String() string {
 	return (*big.Int)(&this).String()
 }
@@ -121,3 +125,8 @@ func (this Int) IsUint64() bool {
 func (this Int) Uint64() uint64 {
 	return (*big.Int)(&this).Uint64()
 }
+
+func (this Int) Float64() float64 {
+	f, _ := new(big.Float).SetInt((*big.Int)(&this)).Float64()
+	return f
+}
@@ -21,6 +21,7 @@ package ipam
 import (
 	"fmt"
 	"net"
+	"time"
 )
 
 type IPAM struct {
@@ -29,6 +30,18 @@ type IPAM struct {
 	nextAlloc     []net.IP
 	roundRobin    bool
 	deletePending CIDRList
+	observer      Observer
+	strategy      Strategy
+	boundary      int
+	hashed        bool
+
+	reserved       CIDRList // requested reserved cidrs
+	applied        CIDRList // reserved cidrs marked as busy
+	reservePending CIDRList // reserved cidrs still allocated
+
+	cooldown time.Duration
+	cooling  []CoolingCIDR
+	clock    func() time.Time
 }
 
 func NewIPAM(cidr *net.IPNet, ranges ...*IPRange) (*IPAM, error) {
@@ -85,19 +98,17 @@ func NewIPAM(cidr *net.IPNet, ranges ...*IPRange) (*IPAM, error) {
 
 func NewIPAMForRanges(ranges IPRanges) (*IPAM, error) {
 	var nextAlloc []net.IP
+	families := ranges.Families()
+	if len(families) > 1 {
+		return nil, fmt.Errorf("ranges must not mix IPv4 and IPv6 addresses: use an IPAM per family")
+	}
 	cidrs, err := Includes(ranges...)
 	if err != nil {
 		return nil, err
 	}
 	cidrs.Sort()
 
-	ipv4 := true
-	for _, cidr := range cidrs {
-		if cidr.IP.To4() == nil {
-			ipv4 = false
-		}
-		break
-	}
+	ipv4 := len(families) == 0 || families[0] == IPv4
 
 	if ipv4 {
 		nextAlloc = make([]net.IP, net.IPv4len*8+1)
@@ -136,11 +147,29 @@ func (this *IPAM) setupFor(ipv4 bool, cidrs ...*net.IPNet) {
 }
 
 func (this *IPAM) AddCIDRs(list CIDRList) {
-	this.insert(this.ranges.AddNormalized(list))
+	added := this.ranges.AddNormalized(list)
+	if len(this.deletePending) != 0 {
+		// ranges still pending for deletion are already
+		// present as blocks, they just have to be revived
+		pending := this.deletePending
+		this.deletePending = added.Additional(pending)
+		added = pending.Additional(added)
+	}
+	this.insert(added)
+	if len(this.reserved) > 0 {
+		this.SetReserved(this.reserved)
+	}
 }
 
 func (this *IPAM) DeleteCIDRs(list CIDRList) {
-	this.delete(this.ranges.DeleteNormalized(list))
+	deleted := this.ranges.DeleteNormalized(list)
+	if len(this.reserved) > 0 {
+		this.unreserve(deleted)
+	}
+	this.delete(deleted)
+	if len(this.reserved) > 0 {
+		this.SetReserved(this.reserved)
+	}
 }
 
 func (this *IPAM) insert(cidrs CIDRList) {
@@ -165,23 +194,21 @@ func (this *IPAM) insert(cidrs CIDRList) {
 func (this *IPAM) delete(cidrs CIDRList) {
 	i := 0
 	for i < len(cidrs) {
-		cidr := cidrs[i]
-		b := this.block
-		for b != nil {
-			match, deleted := this.deletePart(b, cidr)
+		deleted := false
+		for b := this.block; b != nil; b = b.next {
+			match, del := this.deletePart(b, cidrs[i])
 			if match {
-				if deleted {
-					cidrs.DeleteIndex(i)
-				} else {
-					i++
-				}
+				deleted = del
 				break
 			}
-			b = b.next
 		}
-		i++
+		if deleted {
+			cidrs.DeleteIndex(i)
+		} else {
+			i++
+		}
 	}
-	this.deletePending = cidrs
+	this.deletePending.Add(cidrs...)
 }
 
 func (this *IPAM) deletePart(b *Block, cidr *net.IPNet) (bool, bool) {
@@ -296,6 +323,10 @@ func (this *IPAM) Bits() int {
 	// return CIDRBits(this.block.cidr)
 }
 
+func (this *IPAM) Family() string {
+	return BitsFamily(this.Bits())
+}
+
 func (this *IPAM) String() string {
 	s := ""
 	sep := ""
@@ -322,11 +353,26 @@ func (this *IPAM) setNext(cidr *net.IPNet) {
 }
 
 func (this *IPAM) Alloc(reqsize int) *net.IPNet {
+	return this.AllocFor("", reqsize)
+}
+
+// alloc allocates a cidr with the given netmask size. The key is
+// only used in hashed mode.
+func (this *IPAM) alloc(reqsize int, key string) *net.IPNet {
 	var found *Block
 
 	if reqsize < 0 || reqsize > this.Bits() {
 		return nil
 	}
+	if len(this.cooling) > 0 {
+		this.ExpireCooling()
+	}
+	if this.hashed && key != "" {
+		return this.allocHashed(key, reqsize)
+	}
+	if this.strategy != nil {
+		return this.allocByStrategy(reqsize)
+	}
 	next := this.getNext(reqsize)
 
 	for found == nil {
@@ -338,7 +384,7 @@ func (this *IPAM) Alloc(reqsize int) *net.IPNet {
 				}
 			}
 
-			if b.canAlloc(next, reqsize) && (len(this.deletePending) == 0 || this.IsCoveredCIDR(b.cidr)) {
+			if b.canAlloc(next, reqsize, this.avoidMask(b, reqsize)) && (len(this.deletePending) == 0 || this.IsCoveredCIDR(b.cidr)) {
 				if found == nil || s > found.Size() {
 					found = b
 					if found.matchSize(reqsize) {
@@ -358,7 +404,7 @@ func (this *IPAM) Alloc(reqsize int) *net.IPNet {
 	}
 	found = this.split(found, reqsize)
 
-	cidr := found.alloc(next, reqsize)
+	cidr := found.alloc(next, reqsize, this.avoidMask(found, reqsize))
 	if cidr != nil {
 		this.setNext(cidr)
 		this.join(found)
@@ -451,22 +497,32 @@ func (this *IPAM) insertBlock(previous, b *Block) {
 }
 
 func (this *IPAM) Busy(cidr *net.IPNet) bool {
+	if len(this.cooling) > 0 {
+		this.ExpireCooling()
+	}
 	cidr = CIDRAlign(cidr, this.Bits())
 	if cidr == nil {
+		this.observe(OP_BUSY, false)
 		return false
 	}
 	if len(this.deletePending) != 0 && !this.IsCoveredCIDR(cidr) {
+		this.observe(OP_BUSY, false)
 		return false
 	}
-	return this.set(cidr, true)
+	ok := this.set(cidr, true)
+	this.observe(OP_BUSY, ok)
+	return ok
 }
 
 func (this *IPAM) Free(cidr *net.IPNet) bool {
 	cidr = CIDRAlign(cidr, this.Bits())
 	if cidr == nil {
+		this.observe(OP_FREE, false)
 		return false
 	}
-	return this.set(cidr, false)
+	ok := this.release(cidr)
+	this.observe(OP_FREE, ok)
+	return ok
 }
 
 func (this *IPAM) set(cidr *net.IPNet, busy bool) bool {
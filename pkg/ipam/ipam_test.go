@@ -663,6 +663,21 @@ var _ = Describe("IPAM", func() {
 			ipam.Free(r1)
 			Expect(ipam.String()).To(Equal("10.0.0.0/25[free], 10.0.0.128/28[free], 10.0.0.160/28[free]"))
 		})
+
+		It("initializes ipv6 ipam", func() {
+			ipam, err := NewIPAMForRanges(MustParseIPRanges("fd00::/120"))
+
+			Expect(err).To(BeNil())
+			Expect(ipam.Bits()).To(Equal(128))
+			Expect(ipam.Family()).To(Equal(IPv6))
+			Expect(ipam.Alloc(128).String()).To(Equal("fd00::/128"))
+		})
+
+		It("rejects mixed ip families", func() {
+			_, err := NewIPAMForRanges(MustParseIPRanges("fd00::/120", "10.0.0.0/24"))
+
+			Expect(err).To(Equal(fmt.Errorf("ranges must not mix IPv4 and IPv6 addresses: use an IPAM per family")))
+		})
 	})
 
 	Context("serialize blocks", func() {
@@ -1196,5 +1211,56 @@ var _ = Describe("IPAM", func() {
 			Expect(ipam.Alloc(26)).To(BeNil())
 		})
 
+		It("keeps pending deletions of subsequent removals", func() {
+			ranges, err := ParseIPRanges("10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24")
+			Expect(err).To(Succeed())
+			ipam, err := NewIPAMForRanges(ranges)
+			Expect(err).To(Succeed())
+
+			a1 := MustParseCIDR("10.0.1.5/32")
+			a2 := MustParseCIDR("10.0.2.5/32")
+			d1 := MustParseCIDR("10.0.1.0/24")
+			d2 := MustParseCIDR("10.0.2.0/24")
+
+			Expect(ipam.Busy(a1)).To(BeTrue())
+			Expect(ipam.Busy(a2)).To(BeTrue())
+
+			ipam.DeleteCIDRs(CIDRList{d2})
+			Expect(ipam.PendingDeleted()).To(Equal(CIDRList{d2}))
+			ipam.DeleteCIDRs(CIDRList{d1})
+			Expect(ipam.PendingDeleted()).To(Equal(CIDRList{d2, d1}))
+			Expect(ipam.Ranges()).To(Equal(CIDRList{MustParseCIDR("10.0.0.0/24")}))
+
+			Expect(ipam.Free(a2)).To(BeTrue())
+			Expect(ipam.PendingDeleted()).To(Equal(CIDRList{d1}))
+			Expect(ipam.Free(a1)).To(BeTrue())
+			Expect(ipam.PendingDeleted()).To(Equal(CIDRList(nil)))
+
+			blocks, _ := ipam.State()
+			Expect(blocks).To(Equal([]string{"10.0.0.0/24[free]"}))
+		})
+
+		It("revives pending deletion when range is added again", func() {
+			ranges, err := ParseIPRanges("10.0.0.0/24", "10.0.2.0/24")
+			Expect(err).To(Succeed())
+			ipam, err := NewIPAMForRanges(ranges)
+			Expect(err).To(Succeed())
+
+			a1 := MustParseCIDR("10.0.2.5/32")
+			d1 := MustParseCIDR("10.0.2.0/24")
+
+			Expect(ipam.Busy(a1)).To(BeTrue())
+			ipam.DeleteCIDRs(CIDRList{d1})
+			Expect(ipam.PendingDeleted()).To(Equal(CIDRList{d1}))
+			blocks, _ := ipam.State()
+
+			ipam.AddCIDRs(CIDRList{d1})
+			Expect(ipam.PendingDeleted()).To(Equal(CIDRList(nil)))
+			Expect(ipam.Ranges()).To(Equal(CIDRList{MustParseCIDR("10.0.0.0/24"), d1}))
+			now, _ := ipam.State()
+			Expect(now).To(Equal(blocks))
+
+			Expect(ipam.Alloc(32)).To(Equal(MustParseCIDR("10.0.2.0/32")))
+		})
 	})
 })
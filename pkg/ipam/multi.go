@@ -0,0 +1,124 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+)
+
+// AllocMultiple allocates count cidrs with the given netmask size for a key.
+// Either all allocations succeed or none is kept. If contiguous is set, the
+// cidrs are adjacent blocks in address order, otherwise they are allocated
+// one after the other according to the configured mode.
+func (this *IPAM) AllocMultiple(key string, reqsize, count int, contiguous bool) CIDRList {
+	if count <= 0 {
+		return nil
+	}
+	if contiguous {
+		list := this.allocContiguous(reqsize, count)
+		this.observe(OP_ALLOC, list != nil)
+		return list
+	}
+	var list CIDRList
+	for i := 0; i < count; i++ {
+		k := key
+		if i > 0 && key != "" {
+			k = fmt.Sprintf("%s#%d", key, i)
+		}
+		cidr := this.AllocFor(k, reqsize)
+		if cidr == nil {
+			for _, c := range list {
+				this.Revert(c)
+			}
+			return nil
+		}
+		list = append(list, cidr)
+	}
+	return list
+}
+
+// allocContiguous allocates count adjacent cidrs with the given netmask
+// size from the first free area large enough. Runs of single addresses
+// avoid the boundary addresses, they never span a boundary block.
+func (this *IPAM) allocContiguous(reqsize, count int) CIDRList {
+	if reqsize < 0 || reqsize > this.Bits() {
+		return nil
+	}
+	if len(this.cooling) > 0 {
+		this.ExpireCooling()
+	}
+	size := IntOne.LShift(uint(this.Bits() - reqsize))
+	need := size.Mul(Int64(int64(count)))
+	avoid := this.avoidsBoundary(reqsize)
+	if avoid && need.Cmp(IntOne.LShift(uint(this.Bits()-this.boundary)).Sub(Int64(2))) > 0 {
+		return nil
+	}
+
+	var start, last net.IP
+	fits := func() bool {
+		return start != nil && IPDiff(last, start).Add(IntOne).Cmp(need) >= 0
+	}
+	add := func(first, end net.IP) bool {
+		if start == nil || !IPAdd(last, 1).Equal(first) {
+			start = first
+		}
+		last = end
+		return fits()
+	}
+	for b := this.block; b != nil && !fits(); b = b.next {
+		if len(this.deletePending) != 0 && !this.IsCoveredCIDR(b.cidr) {
+			start = nil
+			continue
+		}
+		for _, c := range b.cidrs(b.cidr, false) {
+			if CIDRNetMaskSize(c) > reqsize {
+				// too small to host a cidr of the requested size
+				start = nil
+				continue
+			}
+			if avoid {
+				if this.withoutBoundaries(c, add) {
+					break
+				}
+			} else if add(c.IP, CIDRLastIP(c)) {
+				break
+			}
+		}
+	}
+	if !fits() {
+		return nil
+	}
+
+	var list CIDRList
+	for i := 0; i < count; i++ {
+		cidr := CIDRAlign(&net.IPNet{
+			IP:   IPAddInt(start, size.Mul(Int64(int64(i)))),
+			Mask: net.CIDRMask(reqsize, this.Bits()),
+		}, this.Bits())
+		if cidr == nil || !this.set(cidr, true) {
+			for _, c := range list {
+				this.Revert(c)
+			}
+			return nil
+		}
+		list = append(list, cidr)
+	}
+	return list
+}
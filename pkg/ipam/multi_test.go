@@ -0,0 +1,92 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multiple", func() {
+	var ipam *IPAM
+	ranges := MustParseIPRanges("10.0.0.0/28")
+
+	BeforeEach(func() {
+		ipam, _ = NewIPAMForRanges(ranges)
+	})
+
+	It("allocates scattered cidrs", func() {
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.1/32"))).To(BeTrue())
+		list := ipam.AllocMultiple("", 32, 3, false)
+		Expect(list.String()).To(Equal("[10.0.0.0/32,10.0.0.2/32,10.0.0.3/32]"))
+	})
+
+	It("allocates contiguous cidrs", func() {
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.1/32"))).To(BeTrue())
+		list := ipam.AllocMultiple("", 32, 3, true)
+		Expect(list.String()).To(Equal("[10.0.0.2/32,10.0.0.3/32,10.0.0.4/32]"))
+	})
+
+	It("allocates contiguous cidrs across block boundaries", func() {
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.0/30"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.7/32"))).To(BeTrue())
+		list := ipam.AllocMultiple("", 30, 2, true)
+		Expect(list.String()).To(Equal("[10.0.0.8/30,10.0.0.12/30]"))
+		Expect(ipam.AllocMultiple("", 32, 4, true)).To(BeNil())
+		list = ipam.AllocMultiple("", 32, 3, true)
+		Expect(list.String()).To(Equal("[10.0.0.4/32,10.0.0.5/32,10.0.0.6/32]"))
+	})
+
+	It("keeps nothing if the allocation fails", func() {
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.8/29"))).To(BeTrue())
+		Expect(ipam.AllocMultiple("", 32, 9, false)).To(BeNil())
+		Expect(ipam.AllocMultiple("", 32, 9, true)).To(BeNil())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.0/29"))).To(BeTrue())
+	})
+
+	It("allocates contiguous addresses avoiding boundary addresses", func() {
+		ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/23"))
+		Expect(ipam.SetAvoidBoundaryAddresses(24)).To(BeNil())
+		list := ipam.AllocMultiple("", 32, 3, true)
+		Expect(list.String()).To(Equal("[10.0.0.1/32,10.0.0.2/32,10.0.0.3/32]"))
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.4/30"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.8/29"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.16/28"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.32/27"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.64/26"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.128/26"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.192/27"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.224/28"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.240/29"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.248/30"))).To(BeTrue())
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.252/31"))).To(BeTrue())
+		// 10.0.0.254-10.0.1.1 are free, but include the boundary addresses
+		list = ipam.AllocMultiple("", 32, 2, true)
+		Expect(list.String()).To(Equal("[10.0.1.1/32,10.0.1.2/32]"))
+		Expect(ipam.AllocMultiple("", 32, 254, true)).To(BeNil())
+	})
+
+	It("allocates contiguous cidrs in multiple ranges", func() {
+		ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/30", "10.0.0.4/31", "10.0.1.0/29"))
+		list := ipam.AllocMultiple("", 32, 6, true)
+		Expect(list.String()).To(Equal("[10.0.0.0/32,10.0.0.1/32,10.0.0.2/32,10.0.0.3/32,10.0.0.4/32,10.0.0.5/32]"))
+		list = ipam.AllocMultiple("", 32, 3, true)
+		Expect(list.String()).To(Equal("[10.0.1.0/32,10.0.1.1/32,10.0.1.2/32]"))
+	})
+})
@@ -68,6 +68,12 @@ type RequestSpec interface {
 	String() string
 }
 
+// keyedRequestSpec is implemented by request specs allocating
+// cidrs by size, which are placed according to a key in hashed mode.
+type keyedRequestSpec interface {
+	allocFor(ipam *IPAM, key string) (*net.IPNet, error)
+}
+
 type RequestSpecList []RequestSpec
 
 func (list RequestSpecList) String() string {
@@ -134,7 +140,11 @@ func (this *netmasksizeSpec) Bits() int {
 }
 
 func (this *netmasksizeSpec) Alloc(ipam *IPAM) (*net.IPNet, error) {
-	return this.alloc(ipam, this.size)
+	return this.allocFor(ipam, "")
+}
+
+func (this *netmasksizeSpec) allocFor(ipam *IPAM, key string) (*net.IPNet, error) {
+	return this.alloc(ipam, this.size, key)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -160,7 +170,14 @@ func (this *hostmasksizeSpec) String() string {
 }
 
 func (this *hostmasksizeSpec) Alloc(ipam *IPAM) (*net.IPNet, error) {
-	return this.alloc(ipam, ipam.Bits()-this.size)
+	return this.allocFor(ipam, "")
+}
+
+func (this *hostmasksizeSpec) allocFor(ipam *IPAM, key string) (*net.IPNet, error) {
+	if this.size > ipam.Bits() {
+		return nil, fmt.Errorf("requested host netmask size %d invalid for %d bit network", this.size, ipam.Bits())
+	}
+	return this.alloc(ipam, ipam.Bits()-this.size, key)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -201,11 +218,15 @@ func (this *amountSpec) Bits() int {
 }
 
 func (this *amountSpec) Alloc(ipam *IPAM) (*net.IPNet, error) {
+	return this.allocFor(ipam, "")
+}
+
+func (this *amountSpec) allocFor(ipam *IPAM, key string) (*net.IPNet, error) {
 	bits := this.Bits()
 	if ipam.Bits() < bits {
 		return nil, fmt.Errorf("IPAM too small for %d bit hostnet size", bits)
 	}
-	return this.alloc(ipam, ipam.Bits()-bits)
+	return this.alloc(ipam, ipam.Bits()-bits, key)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -329,6 +350,9 @@ func (this *subSpec) Alloc(ipam *IPAM) (*net.IPNet, error) {
 	if this.host {
 		size = ipam.Bits() - size
 	}
+	if size < 0 || size > ipam.Bits() {
+		return nil, fmt.Errorf("invalid request spec %s for %d bit network", this, ipam.Bits())
+	}
 	for _, r := range ipam.ranges {
 		if CIDRNetMaskSize(r) > size {
 			return nil, fmt.Errorf("invalid request spec %s for ipam ranges", this)
@@ -359,11 +383,14 @@ func (this *subSpec) Alloc(ipam *IPAM) (*net.IPNet, error) {
 
 type specsupport struct{}
 
-func (this specsupport) alloc(ipam *IPAM, size int) (*net.IPNet, error) {
+func (this specsupport) alloc(ipam *IPAM, size int, key string) (*net.IPNet, error) {
+	if size < 0 || size > ipam.Bits() {
+		return nil, fmt.Errorf("requested netmask size %d invalid for %d bit network", size, ipam.Bits())
+	}
 	if err := this.checkForHostMaskSize(ipam, size); err != nil {
 		return nil, err
 	}
-	return ipam.Alloc(size), nil
+	return ipam.AllocFor(key, size), nil
 }
 
 func (this specsupport) checkForHostMaskSize(ipam *IPAM, size int) error {
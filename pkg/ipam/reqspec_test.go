@@ -213,6 +213,27 @@ var _ = Describe("Request Spec", func() {
 			Expect(cidr.String()).To(Equal("10.10.0.0/24"))
 		})
 
+		It("3/%8", func() {
+			req, err := ParseRequestSpec("3/%8")
+			Expect(err).To(BeNil())
+			cidr, err := req.Alloc(ipam)
+			Expect(err).To(BeNil())
+			Expect(cidr).NotTo(BeNil())
+			Expect(cidr.String()).To(Equal("10.1.3.0/24"))
+		})
+		It("33", func() {
+			req, err := ParseRequestSpec("33")
+			Expect(err).To(BeNil())
+			_, err = req.Alloc(ipam)
+			Expect(err).To(Equal(fmt.Errorf("requested netmask size 33 invalid for 32 bit network")))
+		})
+		It("%33", func() {
+			req, err := ParseRequestSpec("%33")
+			Expect(err).To(BeNil())
+			_, err = req.Alloc(ipam)
+			Expect(err).To(Equal(fmt.Errorf("requested host netmask size 33 invalid for 32 bit network")))
+		})
+
 		It("512/24", func() {
 			req, err := ParseRequestSpec("512/24")
 			Expect(err).To(BeNil())
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"net"
+)
+
+// SetReserved sets the cidrs of the IPAM, which must never be allocated.
+// Reserved cidrs inside the ranges of the IPAM are marked as busy, cidrs
+// not reserved anymore are freed again. Reserved cidrs already allocated
+// are returned. They are reserved as soon as they are freed.
+func (this *IPAM) SetReserved(list CIDRList) CIDRList {
+	var wanted CIDRList
+	for _, c := range list {
+		if CIDRBits(c) == this.Bits() {
+			wanted = append(wanted, c)
+		}
+	}
+	this.reserved = wanted
+
+	var applied, pending CIDRList
+	pieces := this.reservable(wanted)
+	for _, c := range this.applied {
+		if pieces.containsEqual(c) {
+			applied = append(applied, c)
+		} else {
+			this.set(c, false)
+		}
+	}
+	for _, c := range pieces {
+		if applied.containsEqual(c) {
+			continue
+		}
+		if this.set(c, true) {
+			applied = append(applied, c)
+		} else {
+			pending = append(pending, c)
+		}
+	}
+	applied.Sort()
+	this.applied = applied
+	this.reservePending = pending
+	return pending.Copy()
+}
+
+// Reserved returns the reserved cidrs marked as busy.
+func (this *IPAM) Reserved() CIDRList {
+	return this.applied.Copy()
+}
+
+// ReservedPending returns the reserved cidrs still allocated.
+func (this *IPAM) ReservedPending() CIDRList {
+	return this.reservePending.Copy()
+}
+
+// ReservedSize returns the number of reserved addresses marked as busy.
+func (this *IPAM) ReservedSize() Int {
+	size := IntZero
+	for _, c := range this.applied {
+		size = size.Add(CIDRHostSize(c))
+	}
+	return size
+}
+
+// reservable returns the parts of the given cidrs inside the ranges
+// of the IPAM.
+func (this *IPAM) reservable(list CIDRList) CIDRList {
+	var pieces CIDRList
+	for _, c := range list {
+		c = CIDRAlign(c, this.Bits())
+		if c == nil {
+			continue
+		}
+		for _, r := range this.ranges {
+			switch {
+			case CIDRContains(r, c):
+				pieces = append(pieces, c)
+			case CIDRContains(c, r):
+				pieces = append(pieces, r)
+			}
+		}
+	}
+	pieces.Normalize()
+	return pieces
+}
+
+// reserveFreed marks reserved cidrs inside a freed cidr as busy.
+func (this *IPAM) reserveFreed(cidr *net.IPNet) {
+	i := 0
+	for i < len(this.reservePending) {
+		c := this.reservePending[i]
+		if CIDROverlap(cidr, c) && this.set(c, true) {
+			this.applied.Add(c)
+			this.applied.Sort()
+			this.reservePending.DeleteIndex(i)
+		} else {
+			i++
+		}
+	}
+}
+
+// unreserve frees the reserved cidrs overlapping with the given cidrs.
+func (this *IPAM) unreserve(list CIDRList) {
+	i := 0
+	for i < len(this.applied) {
+		c := this.applied[i]
+		if list.overlaps(c) {
+			this.set(c, false)
+			this.applied.DeleteIndex(i)
+		} else {
+			i++
+		}
+	}
+}
+
+func (this CIDRList) containsEqual(cidr *net.IPNet) bool {
+	for _, c := range this {
+		if CIDREqual(c, cidr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this CIDRList) overlaps(cidr *net.IPNet) bool {
+	for _, c := range this {
+		if CIDROverlap(c, cidr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reserved", func() {
+	var ipam *IPAM
+
+	reserved := func(s ...string) CIDRList {
+		cidrs, err := Includes(MustParseIPRanges(s...)...)
+		Expect(err).To(BeNil())
+		return cidrs
+	}
+
+	BeforeEach(func() {
+		ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/24"))
+	})
+
+	It("reserves addresses", func() {
+		Expect(ipam.SetReserved(reserved("10.0.0.0", "10.0.0.1", "10.0.0.255"))).To(BeNil())
+		list := ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.0.0/31,10.0.0.255/32]"))
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.2/32"))
+		Expect(ipam.Busy(MustParseCIDR("10.0.0.255/32"))).To(BeFalse())
+	})
+
+	It("accepts address ranges", func() {
+		ipam.SetReserved(reserved("10.0.0.10-10.0.0.13"))
+		list := ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.0.10/31,10.0.0.12/31]"))
+	})
+
+	It("ignores addresses outside the ranges", func() {
+		ipam.SetReserved(reserved("10.0.0.0/16", "fd00::1"))
+		list := ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.0.0/24]"))
+		Expect(ipam.Alloc(32)).To(BeNil())
+	})
+
+	It("releases addresses not reserved anymore", func() {
+		ipam.SetReserved(reserved("10.0.0.0", "10.0.0.1"))
+		ipam.SetReserved(reserved("10.0.0.1"))
+		list := ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.0.1/32]"))
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.0/32"))
+	})
+
+	It("reserves allocated addresses after release", func() {
+		c := ipam.Alloc(32)
+		Expect(c.String()).To(Equal("10.0.0.0/32"))
+		pending := ipam.SetReserved(reserved("10.0.0.0"))
+		Expect(cidrs(pending)).To(Equal("[10.0.0.0/32]"))
+		Expect(ipam.Reserved()).To(BeNil())
+
+		Expect(ipam.Free(c)).To(BeTrue())
+		Expect(ipam.ReservedPending()).To(BeNil())
+		list := ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.0.0/32]"))
+		Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.1/32"))
+	})
+
+	It("follows range changes", func() {
+		ipam.SetReserved(reserved("10.0.0.0", "10.0.1.0"))
+		ipam.AddCIDRs(CIDRList{MustParseCIDR("10.0.1.0/24")})
+		list := ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.0.0/32,10.0.1.0/32]"))
+
+		ipam.DeleteCIDRs(CIDRList{MustParseCIDR("10.0.0.0/24")})
+		Expect(ipam.PendingDeleted()).To(BeNil())
+		list = ipam.Reserved()
+		Expect(cidrs(list)).To(Equal("[10.0.1.0/32]"))
+	})
+
+	It("reports reserved addresses separately", func() {
+		ipam.SetReserved(reserved("10.0.0.0/30"))
+		ipam.Alloc(32)
+		stats := ipam.Stats()
+		Expect(stats.Total).To(Equal(Int64(256)))
+		Expect(stats.Used).To(Equal(Int64(1)))
+		Expect(stats.Reserved).To(Equal(Int64(4)))
+		Expect(stats.Free).To(Equal(Int64(251)))
+	})
+})
@@ -0,0 +1,213 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"math/big"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Strategy selects the cidr used for an allocation. It is called with
+// the maximal free blocks able to host the requested netmask size ordered
+// by address and returns a cidr with the requested netmask size inside
+// one of those blocks or nil.
+// Without a strategy an IPAM uses the first (or the next in round robin
+// mode) block with the smallest adequate size.
+type Strategy interface {
+	Name() string
+	Select(free CIDRList, reqsize int) *net.IPNet
+}
+
+const STRATEGY_BESTFIT = "BestFit"
+const STRATEGY_LASTMATCH = "LastMatch"
+const STRATEGY_RANDOM = "Random"
+
+var strategies = map[string]Strategy{}
+
+func init() {
+	RegisterStrategy(BestFit)
+	RegisterStrategy(LastMatch)
+	RegisterStrategy(NewRandom(rand.NewSource(time.Now().UnixNano())))
+}
+
+// RegisterStrategy registers a strategy under its name.
+func RegisterStrategy(s Strategy) {
+	lock.Lock()
+	defer lock.Unlock()
+	strategies[s.Name()] = s
+}
+
+// GetStrategy returns the strategy registered for the given name or nil.
+func GetStrategy(name string) Strategy {
+	lock.RLock()
+	defer lock.RUnlock()
+	return strategies[name]
+}
+
+// Strategies returns the sorted names of all registered strategies.
+func Strategies() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	var list []string
+	for n := range strategies {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (this *IPAM) SetStrategy(s Strategy) {
+	this.strategy = s
+}
+
+func (this *IPAM) GetStrategy() Strategy {
+	return this.strategy
+}
+
+// allocByStrategy allocates a cidr selected by the configured strategy.
+func (this *IPAM) allocByStrategy(reqsize int) *net.IPNet {
+	free := this.freeCIDRs(reqsize)
+	if len(free) == 0 {
+		return nil
+	}
+	cidr := this.strategy.Select(free, reqsize)
+	if cidr == nil {
+		return nil
+	}
+	cidr = CIDRAlign(cidr, this.Bits())
+	if cidr != nil && this.avoidsBoundary(reqsize) {
+		cidr = this.avoidBoundary(cidr)
+	}
+	if cidr == nil || !this.set(cidr, true) {
+		return nil
+	}
+	return cidr
+}
+
+// freeCIDRs returns the maximal free blocks able to host the
+// requested netmask size ordered by address. Free space in ranges
+// pending for deletion and single boundary addresses to avoid are
+// not considered.
+func (this *IPAM) freeCIDRs(reqsize int) CIDRList {
+	var free CIDRList
+	avoid := this.avoidsBoundary(reqsize)
+	for b := this.block; b != nil; b = b.next {
+		if len(this.deletePending) != 0 && !this.IsCoveredCIDR(b.cidr) {
+			continue
+		}
+		for _, c := range b.cidrs(b.cidr, false) {
+			if CIDRNetMaskSize(c) <= reqsize && !(avoid && CIDRNetMaskSize(c) == reqsize && this.isBoundary(c)) {
+				free = append(free, c)
+			}
+		}
+	}
+	return free
+}
+
+// subCIDR returns the n-th cidr with the given netmask size in a cidr.
+func subCIDR(cidr *net.IPNet, reqsize int, n Int) *net.IPNet {
+	_, bits := cidr.Mask.Size()
+	return &net.IPNet{
+		IP:   CIDRSubIPInt(cidr, n.LShift(uint(bits-reqsize))),
+		Mask: net.CIDRMask(reqsize, bits),
+	}
+}
+
+// subCIDRCount returns the number of cidrs with the given netmask size
+// in a cidr.
+func subCIDRCount(cidr *net.IPNet, reqsize int) Int {
+	return IntOne.LShift(uint(reqsize - CIDRNetMaskSize(cidr)))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type bestFit struct{}
+
+// BestFit allocates from the smallest adequate free block to reduce
+// fragmentation.
+var BestFit Strategy = bestFit{}
+
+func (bestFit) Name() string {
+	return STRATEGY_BESTFIT
+}
+
+func (bestFit) Select(free CIDRList, reqsize int) *net.IPNet {
+	var found *net.IPNet
+	for _, c := range free {
+		if found == nil || CIDRNetMaskSize(c) > CIDRNetMaskSize(found) {
+			found = c
+		}
+	}
+	return subCIDR(found, reqsize, IntZero)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type lastMatch struct{}
+
+// LastMatch allocates from the top of the range.
+var LastMatch Strategy = lastMatch{}
+
+func (lastMatch) Name() string {
+	return STRATEGY_LASTMATCH
+}
+
+func (lastMatch) Select(free CIDRList, reqsize int) *net.IPNet {
+	found := free[len(free)-1]
+	return subCIDR(found, reqsize, subCIDRCount(found, reqsize).Sub(IntOne))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type random struct {
+	lock   sync.Mutex
+	random *rand.Rand
+}
+
+// NewRandom returns a strategy spreading the allocations randomly
+// over all free cidrs using the given random source.
+func NewRandom(src rand.Source) Strategy {
+	return &random{random: rand.New(src)}
+}
+
+func (this *random) Name() string {
+	return STRATEGY_RANDOM
+}
+
+func (this *random) Select(free CIDRList, reqsize int) *net.IPNet {
+	total := IntZero
+	for _, c := range free {
+		total = total.Add(subCIDRCount(c, reqsize))
+	}
+	this.lock.Lock()
+	n := Int(*new(big.Int).Rand(this.random, (*big.Int)(&total)))
+	this.lock.Unlock()
+	for _, c := range free {
+		count := subCIDRCount(c, reqsize)
+		if n.Cmp(count) < 0 {
+			return subCIDR(c, reqsize, n)
+		}
+		n = n.Sub(count)
+	}
+	return nil
+}
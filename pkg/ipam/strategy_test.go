@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strategy", func() {
+
+	It("registers strategies", func() {
+		Expect(Strategies()).To(Equal([]string{STRATEGY_BESTFIT, STRATEGY_LASTMATCH, STRATEGY_RANDOM}))
+		Expect(GetStrategy(STRATEGY_BESTFIT)).To(Equal(BestFit))
+		Expect(GetStrategy("unknown")).To(BeNil())
+	})
+
+	Context("best fit", func() {
+		var ipam *IPAM
+
+		BeforeEach(func() {
+			ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/24"))
+			ipam.Busy(MustParseCIDR("10.0.0.0/30"))
+			ipam.Busy(MustParseCIDR("10.0.0.8/31"))
+			ipam.Busy(MustParseCIDR("10.0.0.12/30"))
+		})
+
+		It("first match uses first free block", func() {
+			Expect(ipam.Alloc(31).String()).To(Equal("10.0.0.4/31"))
+		})
+
+		It("uses smallest free block", func() {
+			ipam.SetStrategy(BestFit)
+			Expect(ipam.Alloc(31).String()).To(Equal("10.0.0.10/31"))
+			Expect(ipam.Alloc(31).String()).To(Equal("10.0.0.4/31"))
+			Expect(ipam.Alloc(31).String()).To(Equal("10.0.0.6/31"))
+			Expect(ipam.Alloc(26).String()).To(Equal("10.0.0.64/26"))
+			Expect(ipam.Alloc(25).String()).To(Equal("10.0.0.128/25"))
+			Expect(ipam.Alloc(25)).To(BeNil())
+		})
+	})
+
+	Context("last match", func() {
+		It("allocates from the top", func() {
+			ipam, _ := NewIPAMForRanges(MustParseIPRanges("10.0.0.0/24"))
+			ipam.SetStrategy(LastMatch)
+			Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.255/32"))
+			Expect(ipam.Alloc(30).String()).To(Equal("10.0.0.248/30"))
+			Expect(ipam.Alloc(32).String()).To(Equal("10.0.0.254/32"))
+			Expect(ipam.Alloc(25).String()).To(Equal("10.0.0.0/25"))
+			Expect(ipam.Alloc(25)).To(BeNil())
+		})
+
+		It("allocates from the top of large ranges", func() {
+			ipam, _ := NewIPAMForRanges(MustParseIPRanges("10.0.0.0/16", "10.2.0.0/24"))
+			ipam.SetStrategy(LastMatch)
+			Expect(ipam.Alloc(24).String()).To(Equal("10.2.0.0/24"))
+			Expect(ipam.Alloc(24).String()).To(Equal("10.0.255.0/24"))
+		})
+	})
+
+	Context("random", func() {
+		It("allocates all addresses", func() {
+			ipam, _ := NewIPAMForRanges(MustParseIPRanges("10.0.0.0/28"))
+			ipam.SetStrategy(NewRandom(rand.NewSource(1)))
+			found := map[string]bool{}
+			sequential := true
+			for i := 0; i < 16; i++ {
+				cidr := ipam.Alloc(32)
+				Expect(cidr).NotTo(BeNil())
+				Expect(ipam.Ranges()[0].Contains(cidr.IP)).To(BeTrue())
+				Expect(found[cidr.String()]).To(BeFalse())
+				found[cidr.String()] = true
+				if cidr.IP[3] != byte(i) {
+					sequential = false
+				}
+			}
+			Expect(sequential).To(BeFalse())
+			Expect(ipam.Alloc(32)).To(BeNil())
+		})
+
+		It("allocates in large ranges", func() {
+			ipam, _ := NewIPAMForRanges(MustParseIPRanges("fd00::/64"))
+			ipam.SetStrategy(NewRandom(rand.NewSource(1)))
+			cidr := ipam.Alloc(120)
+			Expect(cidr).NotTo(BeNil())
+			Expect(CIDRNetMaskSize(cidr)).To(Equal(120))
+			Expect(ipam.Ranges()[0].Contains(cidr.IP)).To(BeTrue())
+			Expect(ipam.Free(cidr)).To(BeTrue())
+			Expect(ipam.Used()).To(Equal(IntZero))
+		})
+	})
+})
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"fmt"
+)
+
+// Operations reported to an Observer.
+const OP_ALLOC = "Alloc"
+const OP_BUSY = "Busy"
+const OP_FREE = "Free"
+
+// Observer is informed about the outcome of the Alloc, Busy and
+// Free operations of an IPAM. It can be used to provide metrics.
+type Observer func(op string, ok bool)
+
+func (this *IPAM) SetObserver(o Observer) {
+	this.observer = o
+}
+
+func (this *IPAM) observe(op string, ok bool) {
+	if this.observer != nil {
+		this.observer(op, ok)
+	}
+}
+
+// Size returns the number of addresses managed by the IPAM including
+// ranges still pending for deletion.
+func (this *IPAM) Size() Int {
+	size := IntZero
+	for b := this.block; b != nil; b = b.next {
+		size = size.Add(CIDRHostSize(b.cidr))
+	}
+	return size
+}
+
+// Used returns the number of allocated addresses. Reserved and cooling
+// addresses are not considered.
+func (this *IPAM) Used() Int {
+	used := IntZero
+	for b := this.block; b != nil; b = b.next {
+		if !b.isBusy() {
+			continue
+		}
+		h := b.HostSize()
+		if h <= MAX_BITMAP_NET {
+			used = used.Add(Int64(int64(bitCount(b.busy & hostmask[h]))))
+		} else {
+			used = used.Add(CIDRHostSize(b.cidr))
+		}
+	}
+	return used.Sub(this.ReservedSize()).Sub(this.CoolingSize())
+}
+
+// FreeBlocks returns the number of maximal free blocks available
+// for allocation per netmask size. Free space in ranges pending for
+// deletion is not considered.
+func (this *IPAM) FreeBlocks() map[int]int {
+	blocks := map[int]int{}
+	for b := this.block; b != nil; b = b.next {
+		if len(this.deletePending) != 0 && !this.IsCoveredCIDR(b.cidr) {
+			continue
+		}
+		s, l := b.cidr.Mask.Size()
+		if l-s <= MAX_BITMAP_NET {
+			freeBitmapBlocks(blocks, b.busy, 0, l-s, l)
+		} else {
+			if !b.isBusy() {
+				blocks[s]++
+			}
+		}
+	}
+	return blocks
+}
+
+// freeBitmapBlocks adds the maximal free buddy blocks of the
+// bitmap area of the given host size starting at start.
+func freeBitmapBlocks(blocks map[int]int, busy Bitmap, start, hostsize, bits int) {
+	if busy&(hostmask[hostsize]<<start) == 0 {
+		blocks[bits-hostsize]++
+		return
+	}
+	if hostsize > 0 {
+		freeBitmapBlocks(blocks, busy, start, hostsize-1, bits)
+		freeBitmapBlocks(blocks, busy, start+(1<<(hostsize-1)), hostsize-1, bits)
+	}
+}
+
+func bitCount(b Bitmap) int {
+	c := 0
+	for b != 0 {
+		b &= b - 1
+		c++
+	}
+	return c
+}
+
+// Stats describes the utilization of an IPAM.
+type Stats struct {
+	// Total is the number of managed addresses
+	Total Int
+	// Used is the number of allocated addresses
+	Used Int
+	// Reserved is the number of reserved addresses
+	Reserved Int
+	// Cooling is the number of released addresses still in
+	// their release cooldown
+	Cooling Int
+	// Free is the number of addresses available for allocation
+	Free Int
+	// FreeBlocks is the number of maximal free blocks per netmask size
+	FreeBlocks map[int]int
+	// LargestFree is the netmask size of the largest allocatable block
+	// or -1 if nothing can be allocated anymore
+	LargestFree int
+	// Fragmentation is the ratio of free addresses not part of the
+	// largest free block. It is 0 for a single free block.
+	Fragmentation float64
+}
+
+// Stats returns the utilization of the IPAM.
+func (this *IPAM) Stats() *Stats {
+	stats := &Stats{
+		Total:       this.Size(),
+		Used:        this.Used(),
+		Reserved:    this.ReservedSize(),
+		Cooling:     this.CoolingSize(),
+		Free:        IntZero,
+		FreeBlocks:  this.FreeBlocks(),
+		LargestFree: -1,
+	}
+	bits := this.Bits()
+	for s, n := range stats.FreeBlocks {
+		stats.Free = stats.Free.Add(IntOne.LShift(uint(bits - s)).Mul(Int64(int64(n))))
+		if stats.LargestFree < 0 || s < stats.LargestFree {
+			stats.LargestFree = s
+		}
+	}
+	if stats.Free.Sgn() > 0 {
+		largest := IntOne.LShift(uint(bits - stats.LargestFree))
+		stats.Fragmentation = 1 - largest.Float64()/stats.Free.Float64()
+	}
+	return stats
+}
+
+func (this *Stats) String() string {
+	return fmt.Sprintf("total %s, used %s, reserved %s, cooling %s, free %s, largest /%d, fragmentation %.2f",
+		this.Total, this.Used, this.Reserved, this.Cooling, this.Free, this.LargestFree, this.Fragmentation)
+}
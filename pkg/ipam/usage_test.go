@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Usage", func() {
+	var ipam *IPAM
+
+	BeforeEach(func() {
+		ipam, _ = NewIPAMForRanges(MustParseIPRanges("10.0.0.0/24", "10.0.2.0/26"))
+	})
+
+	It("reports empty ipam", func() {
+		Expect(ipam.Size()).To(Equal(Int64(320)))
+		Expect(ipam.Used()).To(Equal(IntZero))
+		Expect(ipam.FreeBlocks()).To(Equal(map[int]int{24: 1, 26: 1}))
+	})
+
+	It("reports allocations", func() {
+		ipam.Alloc(32)
+		ipam.Alloc(30)
+		Expect(ipam.Size()).To(Equal(Int64(320)))
+		Expect(ipam.Used()).To(Equal(Int64(5)))
+		Expect(ipam.FreeBlocks()).To(Equal(map[int]int{32: 1, 31: 1, 29: 1, 28: 1, 27: 1, 24: 1}))
+	})
+
+	It("reports busy blocks", func() {
+		ipam.Alloc(25)
+		ipam.Busy(MustParseCIDR("10.0.2.0/26"))
+		Expect(ipam.Used()).To(Equal(Int64(192)))
+		Expect(ipam.FreeBlocks()).To(Equal(map[int]int{25: 1}))
+		Expect(ipam.Size().Sub(ipam.Used()).Float64()).To(Equal(128.0))
+	})
+
+	It("ignores pending deletions", func() {
+		c := ipam.Alloc(32)
+		Expect(c.String()).To(Equal("10.0.2.0/32"))
+		ipam.DeleteCIDRs(CIDRList{MustParseCIDR("10.0.2.0/26")})
+		Expect(ipam.Size()).To(Equal(Int64(320)))
+		Expect(ipam.Used()).To(Equal(Int64(1)))
+		Expect(ipam.FreeBlocks()).To(Equal(map[int]int{24: 1}))
+	})
+
+	It("observes operations", func() {
+		ops := map[string][]bool{}
+		ipam.SetObserver(func(op string, ok bool) {
+			ops[op] = append(ops[op], ok)
+		})
+		c := ipam.Alloc(32)
+		ipam.Alloc(8)
+		ipam.Busy(c)
+		ipam.Free(c)
+		ipam.Free(c)
+		Expect(ops).To(Equal(map[string][]bool{
+			OP_ALLOC: {true, false},
+			OP_BUSY:  {false},
+			OP_FREE:  {true, false},
+		}))
+	})
+
+	Context("stats", func() {
+		It("reports empty ipam", func() {
+			stats := ipam.Stats()
+			Expect(stats.Total).To(Equal(Int64(320)))
+			Expect(stats.Used).To(Equal(IntZero))
+			Expect(stats.Free).To(Equal(Int64(320)))
+			Expect(stats.LargestFree).To(Equal(24))
+			Expect(stats.Fragmentation).To(BeNumerically("~", 0.2))
+			Expect(stats.String()).To(Equal("total 320, used 0, reserved 0, cooling 0, free 320, largest /24, fragmentation 0.20"))
+		})
+
+		It("reports single free block", func() {
+			ipam.Alloc(25)
+			ipam.Busy(MustParseCIDR("10.0.2.0/26"))
+			stats := ipam.Stats()
+			Expect(stats.Used).To(Equal(Int64(192)))
+			Expect(stats.Free).To(Equal(Int64(128)))
+			Expect(stats.FreeBlocks).To(Equal(map[int]int{25: 1}))
+			Expect(stats.LargestFree).To(Equal(25))
+			Expect(stats.Fragmentation).To(Equal(0.0))
+		})
+
+		It("reports fragmentation", func() {
+			ipam.Busy(MustParseCIDR("10.0.2.0/26"))
+			ipam.Busy(MustParseCIDR("10.0.0.0/26"))
+			ipam.Busy(MustParseCIDR("10.0.0.128/26"))
+			stats := ipam.Stats()
+			Expect(stats.Free).To(Equal(Int64(128)))
+			Expect(stats.LargestFree).To(Equal(26))
+			Expect(stats.Fragmentation).To(Equal(0.5))
+		})
+
+		It("reports exhausted ipam", func() {
+			ipam.Busy(MustParseCIDR("10.0.0.0/24"))
+			ipam.Busy(MustParseCIDR("10.0.2.0/26"))
+			stats := ipam.Stats()
+			Expect(stats.Used).To(Equal(Int64(320)))
+			Expect(stats.Free).To(Equal(IntZero))
+			Expect(stats.LargestFree).To(Equal(-1))
+			Expect(stats.Fragmentation).To(Equal(0.0))
+		})
+	})
+})
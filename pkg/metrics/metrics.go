@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gardener/controller-manager-library/pkg/resources"
+	"github.com/gardener/controller-manager-library/pkg/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mandelsoft/kubipam/pkg/ipam"
+)
+
+const NAMESPACE = "kubipam"
+
+var (
+	operations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "ipam",
+			Name:      "operations_total",
+			Help:      "Number of Alloc, Busy and Free operations per range and result.",
+		},
+		[]string{"namespace", "name", "operation", "result"},
+	)
+
+	requestReconcile = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "request",
+			Name:      "reconcile_duration_seconds",
+			Help:      "Latency of the reconciliation of IPAMRequest objects.",
+			Buckets:   prometheus.DefBuckets,
+		},
+	)
+
+	rangeLabels = []string{"namespace", "name", "family"}
+
+	rangeSize = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "addresses"),
+		"Number of addresses managed by a range.",
+		rangeLabels, nil,
+	)
+	rangeAllocated = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "allocated_addresses"),
+		"Number of allocated addresses of a range.",
+		rangeLabels, nil,
+	)
+	rangeReserved = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "reserved_addresses"),
+		"Number of reserved addresses of a range.",
+		rangeLabels, nil,
+	)
+	rangeCooling = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "cooling_addresses"),
+		"Number of released addresses of a range still in their release cooldown.",
+		rangeLabels, nil,
+	)
+	rangeFree = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "free_addresses"),
+		"Number of addresses of a range available for allocation.",
+		rangeLabels, nil,
+	)
+	rangeFreeBlocks = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "free_blocks"),
+		"Number of maximal free blocks of a range available for allocation per prefix length.",
+		append(rangeLabels, "prefix"), nil,
+	)
+	rangeLargestFree = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "largest_free_prefix"),
+		"Prefix length of the largest free block of a range available for allocation.",
+		rangeLabels, nil,
+	)
+	rangeFragmentation = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "range", "fragmentation_ratio"),
+		"Ratio of the free addresses of a range not part of its largest free block.",
+		rangeLabels, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(operations, requestReconcile, collector)
+	server.RegisterHandler("/metrics", promhttp.Handler())
+}
+
+// Observer returns an ipam.Observer counting the operations
+// for the given range.
+func Observer(name resources.ObjectName) ipam.Observer {
+	return func(op string, ok bool) {
+		result := "success"
+		if !ok {
+			result = "failure"
+		}
+		operations.WithLabelValues(name.Namespace(), name.Name(), op, result).Inc()
+	}
+}
+
+// DeleteRange removes the metrics of a deleted range.
+func DeleteRange(name resources.ObjectName) {
+	for _, op := range []string{ipam.OP_ALLOC, ipam.OP_BUSY, ipam.OP_FREE} {
+		for _, result := range []string{"success", "failure"} {
+			operations.DeleteLabelValues(name.Namespace(), name.Name(), op, result)
+		}
+	}
+}
+
+func ObserveRequestReconcile(start time.Time) {
+	requestReconcile.Observe(time.Since(start).Seconds())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// RangeVisitor is called for the IPAM of every ip family of a range.
+type RangeVisitor func(name resources.ObjectName, ipr *ipam.IPAM)
+
+// RangeSource provides the ranges reported by the range metrics.
+type RangeSource interface {
+	VisitRanges(visitor RangeVisitor)
+}
+
+// RegisterRangeSource registers a source for the range metrics.
+func RegisterRangeSource(src RangeSource) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.sources = append(collector.sources, src)
+}
+
+var collector = &rangeCollector{}
+
+// rangeCollector determines the range metrics from the
+// actual state of the ranges whenever they are scraped.
+type rangeCollector struct {
+	lock    sync.Mutex
+	sources []RangeSource
+}
+
+func (this *rangeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rangeSize
+	ch <- rangeAllocated
+	ch <- rangeReserved
+	ch <- rangeCooling
+	ch <- rangeFree
+	ch <- rangeFreeBlocks
+	ch <- rangeLargestFree
+	ch <- rangeFragmentation
+}
+
+func (this *rangeCollector) Collect(ch chan<- prometheus.Metric) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, src := range this.sources {
+		src.VisitRanges(func(name resources.ObjectName, ipr *ipam.IPAM) {
+			labels := []string{name.Namespace(), name.Name(), ipr.Family()}
+			stats := ipr.Stats()
+			ch <- prometheus.MustNewConstMetric(rangeSize, prometheus.GaugeValue, stats.Total.Float64(), labels...)
+			ch <- prometheus.MustNewConstMetric(rangeAllocated, prometheus.GaugeValue, stats.Used.Float64(), labels...)
+			ch <- prometheus.MustNewConstMetric(rangeReserved, prometheus.GaugeValue, stats.Reserved.Float64(), labels...)
+			ch <- prometheus.MustNewConstMetric(rangeCooling, prometheus.GaugeValue, stats.Cooling.Float64(), labels...)
+			ch <- prometheus.MustNewConstMetric(rangeFree, prometheus.GaugeValue, stats.Free.Float64(), labels...)
+			for prefix, n := range stats.FreeBlocks {
+				ch <- prometheus.MustNewConstMetric(rangeFreeBlocks, prometheus.GaugeValue, float64(n), append(labels, strconv.Itoa(prefix))...)
+			}
+			if stats.LargestFree >= 0 {
+				ch <- prometheus.MustNewConstMetric(rangeLargestFree, prometheus.GaugeValue, float64(stats.LargestFree), labels...)
+			}
+			ch <- prometheus.MustNewConstMetric(rangeFragmentation, prometheus.GaugeValue, stats.Fragmentation, labels...)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AdmissionHandler validates an admission request. A returned error
+// denies the request and its message is reported to the client.
+type AdmissionHandler func(logger logger.LogContext, req *admissionv1.AdmissionRequest) error
+
+type handler struct {
+	logger.LogContext
+	name    string
+	handler AdmissionHandler
+}
+
+var _ http.Handler = &handler{}
+
+func (this *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		this.Errorf("cannot read request: %s", err)
+		http.Error(w, fmt.Sprintf("cannot read request: %s", err), http.StatusBadRequest)
+		return
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		if err == nil {
+			err = fmt.Errorf("admission request missing")
+		}
+		this.Errorf("invalid admission review: %s", err)
+		http.Error(w, fmt.Sprintf("invalid admission review: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	req := review.Request
+	response := &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: true,
+	}
+	if err := this.handler(this, req); err != nil {
+		this.Infof("%s of %s %s/%s denied: %s", req.Operation, req.Kind.Kind, req.Namespace, req.Name, err)
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+
+	result := &admissionv1.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: response,
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		this.Errorf("cannot marshal admission response: %s", err)
+		http.Error(w, fmt.Sprintf("cannot marshal admission response: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		this.Errorf("cannot write admission response: %s", err)
+	}
+}
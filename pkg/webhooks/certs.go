@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package webhooks
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gardener/controller-manager-library/pkg/certmgmt"
+	"github.com/gardener/controller-manager-library/pkg/certs"
+	"github.com/gardener/controller-manager-library/pkg/logger"
+)
+
+// fileSource is a certificate source reading the certificate and key
+// from files. It is reloaded if one of the files is modified, for example
+// by updating a mounted secret.
+type fileSource struct {
+	lock     sync.Mutex
+	certFile string
+	keyFile  string
+	modified time.Time
+	cert     *tls.Certificate
+	info     certmgmt.CertificateInfo
+}
+
+var _ certs.CertificateSource = &fileSource{}
+
+func NewFileCertificateSource(certFile, keyFile string) (certs.CertificateSource, error) {
+	this := &fileSource{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := this.load(); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+func (this *fileSource) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, f := range []string{this.certFile, this.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return last, err
+		}
+		if fi.ModTime().After(last) {
+			last = fi.ModTime()
+		}
+	}
+	return last, nil
+}
+
+func (this *fileSource) load() error {
+	modified, err := this.lastModified()
+	if err != nil {
+		return err
+	}
+	if this.cert != nil && !modified.After(this.modified) {
+		return nil
+	}
+	certData, err := ioutil.ReadFile(this.certFile)
+	if err != nil {
+		return err
+	}
+	keyData, err := ioutil.ReadFile(this.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return err
+	}
+	if this.cert != nil {
+		logger.Infof("reloaded webhook certificate from %s", this.certFile)
+	}
+	this.modified = modified
+	this.cert = &cert
+	this.info = certmgmt.NewCertInfo(certData, keyData, nil, nil)
+	return nil
+}
+
+func (this *fileSource) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if err := this.load(); err != nil {
+		logger.Errorf("cannot reload webhook certificate: %s", err)
+	}
+	return this.cert, nil
+}
+
+func (this *fileSource) GetCertificateInfo() certmgmt.CertificateInfo {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.info
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package webhooks
+
+import (
+	"fmt"
+
+	"github.com/gardener/controller-manager-library/pkg/config"
+	areacfg "github.com/gardener/controller-manager-library/pkg/controllermanager/config"
+)
+
+const OPTION_SOURCE = "webhooks"
+
+type Config struct {
+	Port        int
+	BindAddress string
+	CertFile    string
+	KeyFile     string
+
+	config.OptionSet
+}
+
+var _ config.OptionSource = (*Config)(nil)
+
+func NewConfig() *Config {
+	cfg := &Config{
+		OptionSet: config.NewDefaultOptionSet(OPTION_SOURCE, ""),
+	}
+	cfg.AddIntOption(&cfg.Port, "webhook-port", "", 0, "HTTPS port for admission webhooks (0 disables webhooks)")
+	cfg.AddStringOption(&cfg.BindAddress, "webhook-bind-address", "", "", "bind address for admission webhooks")
+	cfg.AddStringOption(&cfg.CertFile, "webhook-cert-file", "", "", "TLS certificate file for admission webhooks")
+	cfg.AddStringOption(&cfg.KeyFile, "webhook-key-file", "", "", "TLS key file for admission webhooks")
+	return cfg
+}
+
+func (this *Config) Evaluate() error {
+	if this.Port > 0 && (this.CertFile == "" || this.KeyFile == "") {
+		return fmt.Errorf("webhook server requires certificate and key file")
+	}
+	return this.OptionSet.Evaluate()
+}
+
+func GetConfig(cfg *areacfg.Config) *Config {
+	return cfg.GetSource(OPTION_SOURCE).(*Config)
+}
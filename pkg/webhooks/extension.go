@@ -0,0 +1,179 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	areacfg "github.com/gardener/controller-manager-library/pkg/controllermanager/config"
+	"github.com/gardener/controller-manager-library/pkg/controllermanager/extension"
+	"github.com/gardener/controller-manager-library/pkg/ctxutil"
+	"github.com/gardener/controller-manager-library/pkg/server"
+	"github.com/gardener/controller-manager-library/pkg/utils"
+)
+
+// TYPE is the name of the controller manager extension. The controller
+// extension of the controller manager is already ordered after an extension
+// with this name.
+const TYPE = "webhooks"
+
+func init() {
+	extension.RegisterExtension(&ExtensionType{})
+}
+
+type webhook struct {
+	name    string
+	path    string
+	handler AdmissionHandler
+}
+
+var lock sync.RWMutex
+var webhooks = map[string]*webhook{}
+
+// Register registers an admission handler under the given name for
+// the given http path.
+func Register(name, path string, handler AdmissionHandler) {
+	lock.Lock()
+	defer lock.Unlock()
+	webhooks[name] = &webhook{name: name, path: server.NormPath(path), handler: handler}
+}
+
+func MustRegister(name, path string, handler AdmissionHandler) {
+	lock.RLock()
+	_, ok := webhooks[name]
+	lock.RUnlock()
+	if ok {
+		panic(fmt.Sprintf("webhook %q already registered", name))
+	}
+	Register(name, path, handler)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type ExtensionType struct{}
+
+var _ extension.ExtensionType = &ExtensionType{}
+
+func (this *ExtensionType) Name() string {
+	return TYPE
+}
+
+func (this *ExtensionType) Definition() extension.Definition {
+	lock.RLock()
+	defer lock.RUnlock()
+	defs := map[string]*webhook{}
+	for n, w := range webhooks {
+		defs[n] = w
+	}
+	return &ExtensionDefinition{
+		ExtensionDefinitionBase: extension.NewExtensionDefinitionBase(TYPE),
+		webhooks:                defs,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type ExtensionDefinition struct {
+	extension.ExtensionDefinitionBase
+	webhooks map[string]*webhook
+}
+
+func (this *ExtensionDefinition) Description() string {
+	return "admission webhooks"
+}
+
+func (this *ExtensionDefinition) Size() int {
+	return len(this.webhooks)
+}
+
+func (this *ExtensionDefinition) Names() utils.StringSet {
+	set := utils.StringSet{}
+	for n := range this.webhooks {
+		set.Add(n)
+	}
+	return set
+}
+
+func (this *ExtensionDefinition) Validate() error {
+	paths := map[string]string{}
+	for n, w := range this.webhooks {
+		if o, ok := paths[w.path]; ok {
+			return fmt.Errorf("webhooks %q and %q use the same path %q", o, n, w.path)
+		}
+		paths[w.path] = n
+	}
+	return nil
+}
+
+func (this *ExtensionDefinition) ExtendConfig(cfg *areacfg.Config) {
+	cfg.AddSource(OPTION_SOURCE, NewConfig())
+}
+
+func (this *ExtensionDefinition) CreateExtension(cm extension.ControllerManager) (extension.Extension, error) {
+	cfg := GetConfig(cm.GetConfig())
+	if cfg.Port <= 0 || len(this.webhooks) == 0 {
+		return nil, nil
+	}
+	ctx := ctxutil.WaitGroupContext(cm.GetContext(), "webhook extension")
+	return &Extension{
+		Environment: extension.NewDefaultEnvironment(ctx, TYPE, cm),
+		config:      cfg,
+		webhooks:    this.webhooks,
+	}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type Extension struct {
+	extension.Environment
+	config   *Config
+	webhooks map[string]*webhook
+}
+
+func (this *Extension) RequiredClusters() (utils.StringSet, error) {
+	return utils.StringSet{}, nil
+}
+
+func (this *Extension) Setup(ctx context.Context) error {
+	return nil
+}
+
+func (this *Extension) Start(ctx context.Context) error {
+	source, err := NewFileCertificateSource(this.config.CertFile, this.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	srv := server.NewHTTPServer(ctx, this, TYPE)
+
+	names := []string{}
+	for n := range this.webhooks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		w := this.webhooks[n]
+		this.Infof("serving webhook %q", n)
+		srv.RegisterHandler(w.path, &handler{LogContext: this.NewContext("webhook", n), name: n, handler: w.handler})
+	}
+	srv.Start(source, this.config.BindAddress, this.config.Port)
+	return nil
+}
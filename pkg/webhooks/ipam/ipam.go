@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Mandelsoft. All rights reserved.
+ *  This file is licensed under the Apache Software License, v. 2 except as noted
+ *  otherwise in the LICENSE file
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gardener/controller-manager-library/pkg/logger"
+	admissionv1 "k8s.io/api/admission/v1"
+
+	api "github.com/mandelsoft/kubipam/pkg/apis/ipam/v1alpha1"
+	"github.com/mandelsoft/kubipam/pkg/apis/ipam/validation"
+	"github.com/mandelsoft/kubipam/pkg/webhooks"
+)
+
+func init() {
+	webhooks.MustRegister("ipamranges", "/validate/ipamranges", ValidateRange)
+	webhooks.MustRegister("clusteripamranges", "/validate/clusteripamranges", ValidateClusterRange)
+	webhooks.MustRegister("ipamrequests", "/validate/ipamrequests", ValidateRequest)
+}
+
+func ValidateRange(logger logger.LogContext, req *admissionv1.AdmissionRequest) error {
+	return validateRange(req, api.IPAMRANGE.Kind, &api.IPAMRange{}, &api.IPAMRange{})
+}
+
+func ValidateClusterRange(logger logger.LogContext, req *admissionv1.AdmissionRequest) error {
+	return validateRange(req, api.CLUSTERIPAMRANGE.Kind, &api.ClusterIPAMRange{}, &api.ClusterIPAMRange{})
+}
+
+// validateRange validates a range object of the given kind using
+// empty objects to unmarshal the new and old object.
+func validateRange(req *admissionv1.AdmissionRequest, kind string, r, o api.RangeObject) error {
+	switch req.Operation {
+	case admissionv1.Create:
+		if err := json.Unmarshal(req.Object.Raw, r); err != nil {
+			return fmt.Errorf("invalid %s object: %s", kind, err)
+		}
+		return validation.ValidateIPAMRange(r)
+	case admissionv1.Update:
+		if err := json.Unmarshal(req.Object.Raw, r); err != nil {
+			return fmt.Errorf("invalid %s object: %s", kind, err)
+		}
+		if err := json.Unmarshal(req.OldObject.Raw, o); err != nil {
+			return fmt.Errorf("invalid old %s object: %s", kind, err)
+		}
+		return validation.ValidateIPAMRangeUpdate(o, r)
+	}
+	return nil
+}
+
+func ValidateRequest(logger logger.LogContext, req *admissionv1.AdmissionRequest) error {
+	switch req.Operation {
+	case admissionv1.Create:
+		r := &api.IPAMRequest{}
+		if err := json.Unmarshal(req.Object.Raw, r); err != nil {
+			return fmt.Errorf("invalid IPAMRequest object: %s", err)
+		}
+		return validation.ValidateIPAMRequest(r)
+	case admissionv1.Update:
+		r := &api.IPAMRequest{}
+		if err := json.Unmarshal(req.Object.Raw, r); err != nil {
+			return fmt.Errorf("invalid IPAMRequest object: %s", err)
+		}
+		o := &api.IPAMRequest{}
+		if err := json.Unmarshal(req.OldObject.Raw, o); err != nil {
+			return fmt.Errorf("invalid old IPAMRequest object: %s", err)
+		}
+		return validation.ValidateIPAMRequestUpdate(o, r)
+	}
+	return nil
+}